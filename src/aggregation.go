@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregationSource is a category of videos or shows to show in the
+// aggregated scopes. An empty Category means a random one of Type.
+type AggregationSource struct {
+	Type     string  `json:"type"` // video or show
+	Category string  `json:"category"`
+	Weight   float64 `json:"weight"`
+	OrderBy  string  `json:"orderby"`
+	Period   string  `json:"period"`
+	Count    int     `json:"count"`
+}
+
+// AggregationRule maps an aggregator keyword to the sources
+type AggregationRule struct {
+	Keyword string              `json:"keyword"`
+	Sources []AggregationSource `json:"sources"`
+}
+
+func (s AggregationSource) withDefaults() AggregationSource {
+	if s.Weight <= 0 {
+		s.Weight = 1
+	}
+	if s.Count <= 0 {
+		s.Count = 10
+	}
+	if s.OrderBy == "" {
+		if s.Type == "show" {
+			s.OrderBy = "view-today-count"
+		} else {
+			s.OrderBy = "view-count"
+		}
+	}
+	if s.Period == "" && s.Type == "video" {
+		s.Period = "today"
+	}
+	return s
+}
+
+// getAggregationRules reads the keyword rules in data/aggregation.json, the
+// earlier rules take precedence
+func getAggregationRules(path string) []AggregationRule {
+
+	f, err := ioutil.ReadFile(path + "/data/aggregation.json")
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []AggregationRule{}
+	}
+
+	var data struct {
+		Keywords []AggregationRule `json:"keywords"`
+	}
+
+	err = json.Unmarshal(f, &data)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []AggregationRule{}
+	}
+	for i, rule := range data.Keywords {
+		for j, source := range rule.Sources {
+			data.Keywords[i].Sources[j] = source.withDefaults()
+		}
+	}
+	return data.Keywords
+}
+
+// pickAggregationSource picks a source weighted randomly from the first rule
+// matching keywords
+func pickAggregationSource(rules []AggregationRule, keywords []string) (AggregationSource, bool) {
+	rand.Seed(time.Now().UnixNano())
+
+	for _, rule := range rules {
+		if !isContainsKey(rule.Keyword, keywords) || len(rule.Sources) == 0 {
+			continue
+		}
+
+		total := 0.0
+		for _, s := range rule.Sources {
+			total += s.Weight
+		}
+		r := rand.Float64() * total
+		for _, s := range rule.Sources {
+			if r < s.Weight {
+				return s, true
+			}
+			r -= s.Weight
+		}
+		return rule.Sources[len(rule.Sources)-1], true
+	}
+	return AggregationSource{}, false
+}
+
+// checkAggregationKeywords logs the differences between the Keywords in
+// scope ini file and the keywords of rules, which should be the same
+func checkAggregationKeywords(path string, rules []AggregationRule) {
+
+	f, err := os.Open(path + "/" + scopeName + ".ini")
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	defer f.Close()
+
+	declared := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "Keywords") {
+			continue
+		}
+		if i := strings.Index(line, "="); i >= 0 {
+			for _, k := range strings.Split(line[i+1:], ";") {
+				if k = strings.TrimSpace(k); k != "" {
+					declared[k] = true
+				}
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		if !declared[rule.Keyword] {
+			logger.Println("[ERROR] keyword not in scope ini:", rule.Keyword)
+		}
+		delete(declared, rule.Keyword)
+	}
+	for k := range declared {
+		logger.Println("[ERROR] keyword without aggregation rule:", k)
+	}
+}
+
+// Max number of results of search in aggregated scopes
+const aggregatedSearchCount = 6
+
+// searchHit is a result of search in aggregated scopes
+type searchHit struct {
+	Item  Renderable
+	Key   string // type_id
+	Score float64
+}
+
+type byScore []searchHit
+
+func (a byScore) Len() int      { return len(a) }
+func (a byScore) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byScore) Less(i, j int) bool {
+	if a[i].Score != a[j].Score {
+		return a[i].Score > a[j].Score
+	}
+	return a[i].Key < a[j].Key
+}
+
+// aggregationSearchSources returns the categories to search for keywords,
+// all the videos and shows if no rule matches
+func aggregationSearchSources(rules []AggregationRule, keywords []string) []AggregationSource {
+	for _, rule := range rules {
+		if !isContainsKey(rule.Keyword, keywords) || len(rule.Sources) == 0 {
+			continue
+		}
+		sources := []AggregationSource{}
+		seen := map[string]bool{}
+		for _, s := range rule.Sources {
+			if !seen[s.Type+"/"+s.Category] {
+				seen[s.Type+"/"+s.Category] = true
+				sources = append(sources, s)
+			}
+		}
+		return sources
+	}
+	return []AggregationSource{
+		AggregationSource{Type: "video"}.withDefaults(),
+		AggregationSource{Type: "show"}.withDefaults(),
+	}
+}
+
+// searchAggregated searches keyword in sources, and ranks the videos and
+// shows by the order of search results, the weight of source and whether
+// the title matches keyword
+func searchAggregated(keyword string, sources []AggregationSource, count int) []Renderable {
+	hits := map[string]searchHit{}
+	add := func(item Renderable, key, title string, rank int, weight float64) {
+		score := weight / float64(rank+1)
+		if strings.Contains(strings.ToLower(title), strings.ToLower(keyword)) {
+			score++
+		}
+		if hit, ok := hits[key]; !ok || score > hit.Score {
+			hits[key] = searchHit{Item: item, Key: key, Score: score}
+		}
+	}
+
+	for _, s := range sources {
+		switch s.Type {
+		case "video":
+			for i, video := range queryVideosByKeyword(keyword, s.Category, "history", "relevance", count) {
+				add(video, "video_"+video.ID, video.Title, i, s.Weight)
+			}
+		case "show":
+			for i, show := range queryShowsByKeyword(keyword, s.Category, 0, "view-count", count) {
+				add(show, "show_"+show.ID, show.Name, i, s.Weight)
+			}
+		}
+	}
+
+	ranked := []searchHit{}
+	for _, hit := range hits {
+		ranked = append(ranked, hit)
+	}
+	sort.Sort(byScore(ranked))
+
+	items := []Renderable{}
+	for i := 0; i < len(ranked) && i < count; i++ {
+		items = append(items, ranked[i].Item)
+	}
+	return items
+}
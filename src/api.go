@@ -1,4 +1,50 @@
 package main
 
-const baseAPI = "https://openapi.youku.com/v2/"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// baseAPI is a variable for the tests to use a local server
+var baseAPI = "https://openapi.youku.com/v2/"
+
 const clientID = "YOUR_CLIENT_ID"
+
+// APIError is the error returned by Youku API
+type APIError struct {
+	Code        int    `json:"code"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("youku api: %d %s: %s", e.Code, e.Type, e.Description)
+}
+
+// getAPI requests api and decodes the response to v. The error of Youku,
+// a bad status or a bad response is returned.
+func getAPI(api string, v interface{}) error {
+	res, err := http.Get(api)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var data struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(body, &data) == nil && data.Error != nil {
+		return data.Error
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("youku api: %s", res.Status)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const categoryCacheTTL = 7 * 24 * time.Hour
+
+func categorySchemaFile(kind, path string) string {
+	return path + "/category_" + kind + ".json"
+}
+
+// getCategorySchema returns the category schema of kind ("video" or "show")
+// cached in path, nil if it is not fetched yet
+func getCategorySchema(kind, path string) []byte {
+	data, err := ioutil.ReadFile(categorySchemaFile(kind, path))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// refreshCategorySchema fetches the category schema of kind from Youku to
+// path if the cached one is older than categoryCacheTTL. The stale one is
+// kept when Youku can not be reached.
+func refreshCategorySchema(kind, path string) {
+	cacheFile := categorySchemaFile(kind, path)
+	if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < categoryCacheTTL {
+		return
+	}
+
+	api := baseAPI + "schemas/" + kind + "/category.json"
+	v := &url.Values{}
+	v.Set("client_id", clientID)
+	api += "?" + v.Encode()
+
+	logger.Println("[CATEGORY SCHEMA]", kind)
+
+	res, err := http.Get(api)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		logger.Println("[ERROR]", "category schema", res.Status)
+		return
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+
+	// the registry never reads a half written schema
+	tmpFile := cacheFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	if err := os.Rename(tmpFile, cacheFile); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// loadCategories returns the categories of kind from Youku merged over the
+// bundled data/category.json, each one in JSON to be decoded by kind
+func loadCategories(kind, scopePath, cachePath string) []json.RawMessage {
+	var data map[string][]json.RawMessage
+	if f, err := ioutil.ReadFile(scopePath + "/data/category.json"); err != nil {
+		logger.Println("[ERROR]", err)
+	} else if err := json.Unmarshal(f, &data); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+
+	var schema struct {
+		Categories []json.RawMessage `json:"categories"`
+	}
+	if f := getCategorySchema(kind, cachePath); f != nil {
+		if err := json.Unmarshal(f, &schema); err != nil {
+			logger.Println("[ERROR]", err)
+		}
+	}
+
+	termOf := func(raw json.RawMessage) string {
+		var c struct {
+			Term string `json:"term"`
+		}
+		json.Unmarshal(raw, &c)
+		return c.Term
+	}
+
+	// categories from Youku take the place of the bundled ones
+	categories := schema.Categories
+	terms := map[string]bool{}
+	for _, c := range schema.Categories {
+		terms[termOf(c)] = true
+	}
+	for _, c := range data[kind] {
+		if !terms[termOf(c)] {
+			categories = append(categories, c)
+		}
+	}
+	return categories
+}
+
+// Category is a category of videos or shows in CategoryRegistry
+type Category struct {
+	Kind   string // video or show
+	Term   string
+	Label  string
+	Lang   string
+	Genres []Genre
+}
+
+// Genre is a genre of Category
+type Genre struct {
+	Term  string
+	Label string
+	Lang  string
+}
+
+// CategoryRegistry to save the categories of videos and shows, which are
+// loaded once and reloaded when the category files change. The schemas of
+// Youku are refreshed in background.
+type CategoryRegistry struct {
+	scopePath string
+	cachePath string
+
+	mutex      sync.Mutex
+	refreshing bool
+	refreshed  time.Time
+	modified   map[string]time.Time
+	categories map[string][]Category
+	byTerm     map[string]Category
+	byLabel    map[string]Category
+}
+
+// NewCategoryRegistry loads the categories bundled in scopePath and cached in
+// cachePath, and refreshes the cached ones in background
+func NewCategoryRegistry(scopePath, cachePath string) *CategoryRegistry {
+	r := &CategoryRegistry{
+		scopePath:  scopePath,
+		cachePath:  cachePath,
+		refreshing: true,
+	}
+	r.load()
+	go r.refresh()
+	return r
+}
+
+// refresh fetches the schemas of Youku, the registry picks them up by
+// reload once the cached files change
+func (r *CategoryRegistry) refresh() {
+	for _, kind := range []string{"video", "show"} {
+		refreshCategorySchema(kind, r.cachePath)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.refreshing = false
+	r.refreshed = time.Now()
+}
+
+func (r *CategoryRegistry) files() []string {
+	return []string{
+		r.scopePath + "/data/category.json",
+		r.cachePath + "/category_video.json",
+		r.cachePath + "/category_show.json",
+	}
+}
+
+func (r *CategoryRegistry) load() {
+	r.categories = map[string][]Category{}
+	r.byTerm = map[string]Category{}
+	r.byLabel = map[string]Category{}
+
+	for _, v := range getVideoCategories(r.scopePath, r.cachePath) {
+		c := Category{Kind: "video", Term: v.Term, Label: v.Label, Lang: v.Lang}
+		for _, g := range v.Genres {
+			c.Genres = append(c.Genres, Genre{Term: g.Term, Label: g.Label, Lang: g.Lang})
+		}
+		r.add(c)
+	}
+	for _, v := range getShowCategories(r.scopePath, r.cachePath) {
+		c := Category{Kind: "show", Term: v.Term, Label: v.Label, Lang: v.Lang}
+		for _, g := range v.Genre {
+			c.Genres = append(c.Genres, Genre{Term: g.Term, Label: g.Label, Lang: g.Lang})
+		}
+		r.add(c)
+	}
+
+	r.modified = map[string]time.Time{}
+	for _, f := range r.files() {
+		if info, err := os.Stat(f); err == nil {
+			r.modified[f] = info.ModTime()
+		}
+	}
+	logger.Println("[CATEGORY] loaded", len(r.categories["video"]), len(r.categories["show"]))
+}
+
+func (r *CategoryRegistry) add(c Category) {
+	r.categories[c.Kind] = append(r.categories[c.Kind], c)
+	r.byTerm[c.Kind+"/"+c.Term] = c
+	r.byLabel[c.Kind+"/"+c.Label] = c
+}
+
+// reload loads the categories again if any category file changed, and
+// refreshes the schemas in background when they expired
+func (r *CategoryRegistry) reload() {
+	if !r.refreshing && time.Since(r.refreshed) > categoryCacheTTL {
+		r.refreshing = true
+		go r.refresh()
+	}
+
+	changed := false
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modified[f]) {
+			changed = true
+		}
+	}
+	if changed {
+		r.load()
+	}
+}
+
+// Categories returns the categories of kind
+func (r *CategoryRegistry) Categories(kind string) []Category {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return r.categories[kind]
+}
+
+// CategoryByTerm looks up the category of kind by term
+func (r *CategoryRegistry) CategoryByTerm(kind, term string) (Category, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	c, ok := r.byTerm[kind+"/"+term]
+	return c, ok
+}
+
+// CategoryByLabel looks up the category of kind by label
+func (r *CategoryRegistry) CategoryByLabel(kind, label string) (Category, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	c, ok := r.byLabel[kind+"/"+label]
+	return c, ok
+}
+
+// GenresOf returns the genres of the category of kind with label
+func (r *CategoryRegistry) GenresOf(kind, label string) []Genre {
+	c, _ := r.CategoryByLabel(kind, label)
+	return c.Genres
+}
+
+// GenreByTerm looks up the genre of category by term
+func (c Category) GenreByTerm(term string) (Genre, bool) {
+	for _, g := range c.Genres {
+		if g.Term == term {
+			return g, true
+		}
+	}
+	return Genre{}, false
+}
+
+// APIValues maps the terms of department to the category and genre values
+// expected by Youku API
+func (r *CategoryRegistry) APIValues(d DepartmentID) (category, genre string) {
+	if d.Term == "" {
+		return "", ""
+	}
+	c, ok := r.CategoryByTerm(d.Kind, d.Term)
+	if !ok {
+		logger.Println("[ERROR] unknown category:", d)
+		return "", ""
+	}
+	if g, ok := c.GenreByTerm(d.Genre); ok {
+		genre = g.Label
+	}
+	return c.Label, genre
+}
+
+// Label returns the label of the category of kind in locale l.
+// label is the value expected by Youku API.
+func (r *CategoryRegistry) Label(l Locale, kind, label string) string {
+	if l.isChinese() || label == "" {
+		return label
+	}
+	if c, ok := r.CategoryByLabel(kind, label); ok {
+		return termLabel(c.Term)
+	}
+	return l.tr(label)
+}
+
+// GenreLabel returns the label of the genre of category in locale l
+func (r *CategoryRegistry) GenreLabel(l Locale, kind, category, genre string) string {
+	if l.isChinese() || genre == "" {
+		return genre
+	}
+	for _, g := range r.GenresOf(kind, category) {
+		if g.Label == genre {
+			return termLabel(g.Term)
+		}
+	}
+	return l.tr(genre)
+}
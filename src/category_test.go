@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// The categories of Youku take the place of the bundled ones with the same
+// term, the others are kept
+func TestLoadCategories(t *testing.T) {
+	cache, err := ioutil.TempDir("", "youku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	bundled := getVideoCategories("..", cache)
+	if len(bundled) == 0 || len(getShowCategories("..", cache)) == 0 {
+		t.Fatal("no bundled categories")
+	}
+
+	schema := `{"categories": [
+		{"term": "` + bundled[0].Term + `", "label": "新标签", "genres": [{"term": "g", "label": "新类型"}]},
+		{"term": "New", "label": "新分类"}
+	]}`
+	if err := ioutil.WriteFile(categorySchemaFile("video", cache), []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := getVideoCategories("..", cache)
+	if len(merged) != len(bundled)+1 {
+		t.Fatalf("%d categories, want %d", len(merged), len(bundled)+1)
+	}
+	if merged[0].Label != "新标签" || len(merged[0].Genres) != 1 || merged[1].Term != "New" {
+		t.Errorf("categories from Youku: %+v %+v", merged[0], merged[1])
+	}
+	for i, c := range bundled[1:] {
+		if merged[i+2].Term != c.Term {
+			t.Errorf("category %d = %q, want %q", i+2, merged[i+2].Term, c.Term)
+		}
+	}
+}
@@ -40,7 +40,9 @@ func getCommentsByVideo(videoID string, count int) []Comment {
 	}
 
 	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&data)
+	if err := decoder.Decode(&data); err != nil {
+		logger.Println("[ERROR]", "json parse", err)
+	}
 
 	return data.Comments
 }
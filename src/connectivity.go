@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"launchpad.net/go-dbus/v1"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The connectivity service of the platform on the session bus
+const (
+	connectivityService   = "com.ubuntu.connectivity1"
+	connectivityPath      = "/com/ubuntu/connectivity1/NetworkingStatus"
+	connectivityInterface = "com.ubuntu.connectivity1.NetworkingStatus"
+)
+
+var errNoNetworkStatus = errors.New("cannot detect network")
+
+var (
+	connectivityMutex sync.Mutex
+	connectivityConn  *dbus.Connection
+)
+
+// onWiFi reports whether the network is not metered. The connectivity
+// service is used, the wireless interfaces are checked if it fails.
+func onWiFi() (bool, error) {
+	wifi, err := connectivityOnWiFi()
+	if err == nil {
+		return wifi, nil
+	}
+	logger.Println("[ERROR]", "connectivity", err)
+
+	wifi, err = sysfsOnWiFi()
+	if err != nil {
+		logger.Println("[ERROR]", "connectivity", err)
+		return false, errNoNetworkStatus
+	}
+	return wifi, nil
+}
+
+// connectivityOnWiFi asks the connectivity service if the network is online
+// without the bandwith limitation of mobile data
+func connectivityOnWiFi() (bool, error) {
+	connectivityMutex.Lock()
+	defer connectivityMutex.Unlock()
+
+	if connectivityConn == nil {
+		conn, err := dbus.Connect(dbus.SessionBus)
+		if err != nil {
+			return false, err
+		}
+		connectivityConn = conn
+	}
+
+	obj := connectivityConn.Object(connectivityService, dbus.ObjectPath(connectivityPath))
+	get := func(property string) (interface{}, error) {
+		reply, err := obj.Call("org.freedesktop.DBus.Properties", "Get", connectivityInterface, property)
+		if err != nil {
+			return nil, err
+		}
+		var v dbus.Variant
+		if err := reply.Args(&v); err != nil {
+			return nil, err
+		}
+		return v.Value, nil
+	}
+
+	status, err := get("Status")
+	if err != nil {
+		// connect again next time
+		connectivityConn.Close()
+		connectivityConn = nil
+		return false, err
+	}
+	if status != "online" {
+		return false, nil
+	}
+
+	limitations, err := get("Limitations")
+	if err != nil {
+		return false, err
+	}
+	switch limitations := limitations.(type) {
+	case []string:
+		return !isContainsKey("bandwith", limitations), nil
+	case []interface{}:
+		for _, l := range limitations {
+			if l == "bandwith" {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, errNoNetworkStatus
+}
+
+// sysfsOnWiFi reports whether a wireless network interface is up
+func sysfsOnWiFi() (bool, error) {
+	ifaces, err := filepath.Glob("/sys/class/net/*")
+	if err != nil {
+		return false, err
+	}
+	if len(ifaces) == 0 {
+		return false, errNoNetworkStatus
+	}
+	for _, iface := range ifaces {
+		if _, err := os.Stat(iface + "/wireless"); err != nil {
+			continue
+		}
+		state, err := ioutil.ReadFile(iface + "/operstate")
+		if err == nil && strings.TrimSpace(string(state)) == "up" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
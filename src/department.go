@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DepartmentID is the structured ID of department like
+// "video/<term>/<genre-term>". Kind is empty for home.
+type DepartmentID struct {
+	Kind  string
+	Term  string
+	Genre string
+}
+
+// ParseDepartmentID parses the ID of department
+func ParseDepartmentID(id string) DepartmentID {
+	var d DepartmentID
+	parts := strings.SplitN(id, "/", 3)
+	for i, part := range parts {
+		if p, err := url.PathUnescape(part); err == nil {
+			part = p
+		}
+		switch i {
+		case 0:
+			d.Kind = part
+		case 1:
+			d.Term = part
+		case 2:
+			d.Genre = part
+		}
+	}
+	return d
+}
+
+func (d DepartmentID) String() string {
+	parts := []string{}
+	for _, part := range []string{d.Kind, d.Term, d.Genre} {
+		if part == "" {
+			break
+		}
+		parts = append(parts, url.PathEscape(part))
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"launchpad.net/go-unityscopes/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	downloadsFile       = "/downloads.json"
+	downloadsDir        = "/downloads"
+	downloadConcurrency = 2
+	downloadSaveSize    = 1024 * 1024
+	downloadReportSize  = 256 * 1024
+)
+
+// Status of download
+const (
+	downloadQueued      = "queued"
+	downloadRunning     = "downloading"
+	downloadDone        = "done"
+	downloadFailed      = "failed"
+	downloadWaitingWiFi = "waiting"
+)
+
+var (
+	errDownloadRemoved = errors.New("download removed")
+	errQuotaExceeded   = errors.New("storage quota exceeded")
+	errNoWiFi          = errors.New("not on Wi-Fi")
+)
+
+// DownloadItem to save a video downloaded for offline viewing
+type DownloadItem struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Thumbnail  string    `json:"thumbnail"`
+	Link       string    `json:"link"`
+	Duration   FlexFloat `json:"duration"`
+	StreamType string    `json:"stream_type"`
+	Format     string    `json:"format"` // m3u8 or mp4
+	URL        string    `json:"url"`
+	File       string    `json:"file"`
+	Size       int64     `json:"size"` // 0 if unknown
+	Downloaded int64     `json:"downloaded"`
+	Segment    int       `json:"segment"` // the next segment of m3u8
+	Segments   int       `json:"segments"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Added      int64     `json:"added"`
+}
+
+// Progress returns the percentage downloaded, -1 if unknown
+func (item DownloadItem) Progress() int {
+	switch {
+	case item.Status == downloadDone:
+		return 100
+	case item.Segments > 0:
+		return item.Segment * 100 / item.Segments
+	case item.Size > 0:
+		return int(item.Downloaded * 100 / item.Size)
+	}
+	return -1
+}
+
+// StatusLabel returns the status to show to user
+func (item DownloadItem) StatusLabel(l Locale) string {
+	switch item.Status {
+	case downloadDone:
+		return l.tr("已下载")
+	case downloadRunning:
+		if p := item.Progress(); p >= 0 {
+			return fmt.Sprintf(l.tr("下载中 %d%%"), p)
+		}
+		return l.tr("下载中")
+	case downloadWaitingWiFi:
+		return l.tr("等待 Wi-Fi")
+	case downloadFailed:
+		return l.tr("下载失败")
+	}
+	return l.tr("等待下载")
+}
+
+// Render sets the card of download to result
+func (item DownloadItem) Render(result *scopes.CategorisedResult, l Locale) {
+	result.SetTitle(item.Title)
+	result.SetArt(item.Thumbnail)
+	result.SetURI(item.Link)
+	result.Set("subtitle", item.StatusLabel(l))
+	result.Set("attributes", []map[string]string{
+		{"value": fmt.Sprintf("🕒%s", formatDuration(item.Duration))},
+		{"value": formatSize(item.Downloaded)},
+	})
+	result.Set("download_id", item.ID)
+	result.Set("type", "download")
+}
+
+// DownloadManager downloads the videos in queue to the cache directory,
+// at most Concurrency at the same time
+type DownloadManager struct {
+	path        string
+	Concurrency int
+	WiFiOnly    bool
+	Quota       int64 // bytes, 0 for no limit
+
+	mutex   sync.Mutex
+	items   []DownloadItem
+	running map[string]*downloadRun
+	client  *http.Client
+}
+
+// downloadRun is a running download, which is cancelled when the download
+// is removed. A new download of the same video waits until it stops.
+type downloadRun struct {
+	cancelled bool
+}
+
+// NewDownloadManager to create a DownloadManager saving the files in path,
+// the unfinished downloads are queued again
+func NewDownloadManager(path string) *DownloadManager {
+	m := &DownloadManager{
+		path:        path,
+		Concurrency: downloadConcurrency,
+		WiFiOnly:    true,
+		running:     map[string]*downloadRun{},
+		client:      &http.Client{},
+	}
+
+	if err := os.MkdirAll(path+downloadsDir, 0755); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+
+	f, err := ioutil.ReadFile(path + downloadsFile)
+	if err == nil {
+		if err := json.Unmarshal(f, &m.items); err != nil {
+			logger.Println("[ERROR]", err)
+		}
+	}
+	for i, item := range m.items {
+		if item.Status == downloadRunning {
+			m.items[i].Status = downloadQueued
+		}
+	}
+	return m
+}
+
+// Configure updates the settings and starts the queued downloads. It is
+// called on every query, so nothing is done unless the settings changed or
+// some downloads wait.
+func (m *DownloadManager) Configure(wifiOnly bool, quotaMB float64) {
+	quota := int64(quotaMB * 1024 * 1024)
+
+	m.mutex.Lock()
+	changed := m.WiFiOnly != wifiOnly || m.Quota != quota
+	m.WiFiOnly, m.Quota = wifiOnly, quota
+	pending := m.pending()
+	m.mutex.Unlock()
+
+	if changed || pending {
+		m.schedule()
+	}
+}
+
+// Items returns the downloads, the latest first
+func (m *DownloadManager) Items() []DownloadItem {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	items := make([]DownloadItem, len(m.items))
+	copy(items, m.items)
+	return items
+}
+
+// Item returns the download of video
+func (m *DownloadManager) Item(id string) (DownloadItem, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if i := m.indexOf(id); i >= 0 {
+		return m.items[i], true
+	}
+	return DownloadItem{}, false
+}
+
+// FilePath returns the local file of download
+func (m *DownloadManager) FilePath(item DownloadItem) string {
+	return m.path + downloadsDir + "/" + item.File
+}
+
+// Enqueue adds a download of video in stream, a failed one is restarted
+func (m *DownloadManager) Enqueue(video VideoDetail, stream Stream) {
+	m.mutex.Lock()
+
+	if i := m.indexOf(video.ID); i >= 0 {
+		if item := &m.items[i]; item.Status == downloadFailed {
+			if item.Format != stream.Format {
+				os.Remove(m.FilePath(*item))
+				item.Format, item.File = stream.Format, video.ID+streamExt(stream)
+				item.Size, item.Downloaded, item.Segment, item.Segments = 0, 0, 0, 0
+			}
+			item.StreamType, item.URL = stream.Type, stream.URL
+			item.Status, item.Error = downloadQueued, ""
+			m.save()
+		}
+		m.mutex.Unlock()
+		m.schedule()
+		return
+	}
+
+	item := DownloadItem{
+		ID:         video.ID,
+		Title:      video.Title,
+		Thumbnail:  video.Thumbnail,
+		Link:       video.Link,
+		Duration:   video.Duration,
+		StreamType: stream.Type,
+		Format:     stream.Format,
+		URL:        stream.URL,
+		File:       video.ID + streamExt(stream),
+		Status:     downloadQueued,
+		Added:      time.Now().Unix(),
+	}
+	m.items = append([]DownloadItem{item}, m.items...)
+	m.save()
+	m.mutex.Unlock()
+
+	logger.Println("[DOWNLOAD] enqueue", item.ID, item.Title)
+	m.schedule()
+}
+
+// Remove deletes the download and its file, a running one is stopped
+func (m *DownloadManager) Remove(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return
+	}
+	if run, ok := m.running[id]; ok {
+		run.cancelled = true
+	}
+	if err := os.Remove(m.FilePath(m.items[i])); err != nil && !os.IsNotExist(err) {
+		logger.Println("[ERROR]", err)
+	}
+	m.items = append(m.items[:i], m.items[i+1:]...)
+	m.save()
+}
+
+// streamExt returns the extension of the file of stream
+func streamExt(stream Stream) string {
+	if stream.Format == "m3u8" {
+		return ".ts"
+	}
+	return ".mp4"
+}
+
+func (m *DownloadManager) indexOf(id string) int {
+	for i, item := range m.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *DownloadManager) save() {
+	f, err := json.Marshal(m.items)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	err = ioutil.WriteFile(m.path+downloadsFile, f, 0644)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// usage returns the bytes of all the downloads
+func (m *DownloadManager) usage() int64 {
+	var total int64
+	for _, item := range m.items {
+		total += item.Downloaded
+	}
+	return total
+}
+
+// pending reports whether there are free slots for the downloads waiting
+func (m *DownloadManager) pending() bool {
+	if len(m.running) >= m.Concurrency {
+		return false
+	}
+	for _, item := range m.items {
+		if item.Status != downloadQueued && item.Status != downloadWaitingWiFi {
+			continue
+		}
+		if _, ok := m.running[item.ID]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule starts the queued downloads if there are free slots
+func (m *DownloadManager) schedule() {
+	m.mutex.Lock()
+	wifiOnly, pending := m.WiFiOnly, m.pending()
+	m.mutex.Unlock()
+
+	if !pending {
+		return
+	}
+
+	wifi, wifiErr := true, error(nil)
+	if wifiOnly {
+		wifi, wifiErr = onWiFi()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changed := false
+	for i, item := range m.items {
+		if len(m.running) >= m.Concurrency {
+			break
+		}
+		if item.Status != downloadQueued && item.Status != downloadWaitingWiFi {
+			continue
+		}
+		// a removed download is still stopping
+		if _, ok := m.running[item.ID]; ok {
+			continue
+		}
+		if !wifi {
+			status, message := downloadWaitingWiFi, ""
+			if wifiErr != nil {
+				message = "无法检测网络" // translated when shown
+			}
+			if item.Status != status || item.Error != message {
+				m.items[i].Status, m.items[i].Error = status, message
+				changed = true
+			}
+			continue
+		}
+		run := &downloadRun{}
+		m.running[item.ID] = run
+		m.items[i].Status, m.items[i].Error = downloadRunning, ""
+		changed = true
+		go m.run(item, run)
+	}
+	if changed {
+		m.save()
+	}
+}
+
+func (m *DownloadManager) run(item DownloadItem, run *downloadRun) {
+	logger.Println("[DOWNLOAD] start", item.ID, item.Format, item.URL)
+
+	var err error
+	if item.Format == "m3u8" {
+		err = m.fetchPlaylist(item)
+	} else {
+		err = m.fetchFile(item)
+	}
+
+	m.mutex.Lock()
+	delete(m.running, item.ID)
+	if run.cancelled {
+		// the file may be created again after it is removed
+		os.Remove(m.FilePath(item))
+		err = errDownloadRemoved
+	} else if i := m.indexOf(item.ID); i >= 0 {
+		switch err {
+		case nil:
+			m.items[i].Status = downloadDone
+		case errNoWiFi:
+			m.items[i].Status = downloadWaitingWiFi
+		case errQuotaExceeded:
+			// free the space of the partial file
+			if err := os.Remove(m.FilePath(item)); err != nil && !os.IsNotExist(err) {
+				logger.Println("[ERROR]", err)
+			}
+			m.items[i].Downloaded, m.items[i].Segment = 0, 0
+			m.items[i].Status = downloadFailed
+			m.items[i].Error = err.Error()
+		default:
+			m.items[i].Status = downloadFailed
+			m.items[i].Error = err.Error()
+		}
+		m.save()
+	}
+	m.mutex.Unlock()
+
+	if err != nil && err != errDownloadRemoved {
+		logger.Println("[ERROR]", "download", item.ID, err)
+	}
+	logger.Println("[DOWNLOAD] end", item.ID)
+
+	if err != errNoWiFi {
+		m.schedule()
+	}
+}
+
+// update changes the download of id by f, returns an error if the download
+// should stop. The quota and network are checked only when the change is
+// persisted.
+func (m *DownloadManager) update(id string, persist bool, f func(*DownloadItem)) error {
+	if err := m.apply(id, persist, f); err != nil || !persist {
+		return err
+	}
+
+	m.mutex.Lock()
+	wifiOnly := m.WiFiOnly
+	m.mutex.Unlock()
+	if wifiOnly {
+		if wifi, _ := onWiFi(); !wifi {
+			return errNoWiFi
+		}
+	}
+	return nil
+}
+
+func (m *DownloadManager) apply(id string, persist bool, f func(*DownloadItem)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	i := m.indexOf(id)
+	if run := m.running[id]; i < 0 || run == nil || run.cancelled {
+		return errDownloadRemoved
+	}
+	f(&m.items[i])
+	if !persist {
+		return nil
+	}
+	if m.Quota > 0 && m.usage() > m.Quota {
+		return errQuotaExceeded
+	}
+	m.save()
+	return nil
+}
+
+// checkQuota returns errQuotaExceeded if the download of id in size does
+// not fit in the quota with the other downloads
+func (m *DownloadManager) checkQuota(id string, size int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.Quota <= 0 {
+		return nil
+	}
+	usage := m.usage()
+	if i := m.indexOf(id); i >= 0 {
+		usage -= m.items[i].Downloaded
+	}
+	if usage+size > m.Quota {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// fetchFile downloads a single file, resuming from the size of the partial
+// file with HTTP Range
+func (m *DownloadManager) fetchFile(item DownloadItem) error {
+	file := m.FilePath(item)
+
+	var offset int64
+	if info, err := os.Stat(file); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest("GET", item.URL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// the server does not support Range
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// downloaded already
+		return m.update(item.ID, true, func(d *DownloadItem) { d.Downloaded = offset })
+	default:
+		return fmt.Errorf("download: %s", res.Status)
+	}
+
+	size := int64(0)
+	if res.ContentLength > 0 {
+		size = offset + res.ContentLength
+		if err := m.checkQuota(item.ID, size); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(file, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return m.copy(item.ID, f, res.Body, offset, func(d *DownloadItem) { d.Size = size })
+}
+
+// fetchPlaylist downloads the segments of a HLS playlist into a single file,
+// resuming from the next segment
+func (m *DownloadManager) fetchPlaylist(item DownloadItem) error {
+	segments, err := m.playlistSegments(item.URL)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return ErrNoStream
+	}
+
+	// drop the partial segment, or start again if the file is lost
+	file := m.FilePath(item)
+	if info, err := os.Stat(file); err != nil || info.Size() < item.Downloaded {
+		item.Segment, item.Downloaded = 0, 0
+	}
+	if err := os.Truncate(file, item.Downloaded); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset := item.Downloaded
+	for i := item.Segment; i < len(segments); i++ {
+		res, err := m.client.Get(segments[i])
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return fmt.Errorf("download segment %d: %s", i, res.Status)
+		}
+		err = m.copy(item.ID, f, res.Body, offset, func(d *DownloadItem) { d.Segments = len(segments) })
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		offset = info.Size()
+		next := i + 1
+		if err := m.update(item.ID, true, func(d *DownloadItem) {
+			d.Segment = next
+			d.Downloaded = offset
+		}); err != nil {
+			return err
+		}
+
+		// estimate the size by the segments downloaded
+		if i == item.Segment {
+			if err := m.checkQuota(item.ID, offset*int64(len(segments))/int64(next)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// playlistSegments returns the URLs of segments in playlist, the first
+// variant is used for a master playlist
+func (m *DownloadManager) playlistSegments(playlist string) ([]string, error) {
+	base, err := url.Parse(playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := m.client.Get(playlist)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("playlist: %s", res.Status)
+	}
+
+	uris := []string{}
+	variant := false
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			variant = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := base.Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		if variant {
+			return m.playlistSegments(u.String())
+		}
+		uris = append(uris, u.String())
+	}
+	return uris, scanner.Err()
+}
+
+// copy writes src to dst and updates the progress of download every
+// downloadReportSize, which is saved every downloadSaveSize
+func (m *DownloadManager) copy(id string, dst io.Writer, src io.Reader, offset int64, f func(*DownloadItem)) error {
+	buf := make([]byte, 64*1024)
+	written, reported, saved := offset, offset, offset
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err == io.EOF || written-reported >= downloadReportSize {
+			reported = written
+			persist := written-saved >= downloadSaveSize
+			if persist {
+				saved = written
+			}
+			if err := m.update(id, persist, func(d *DownloadItem) {
+				d.Downloaded = written
+				f(d)
+			}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024*1024:
+		return fmt.Sprintf("%.1fG", float64(size)/(1024*1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fM", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.0fK", float64(size)/1024)
+	}
+	return fmt.Sprintf("%dB", size)
+}
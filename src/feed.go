@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	feedMaxCount   = 100
+	youkuHomeLink  = "http://www.youku.com/"
+	sokuSearchLink = "http://www.soku.com/search_video/q_"
+)
+
+// Time of Youku is in China Standard Time
+var youkuLocation = time.FixedZone("CST", 8*60*60)
+
+// The feeds are in Chinese like Youku
+var feedLocale = Locale{}
+
+// FeedRequest to save what to put in a feed
+type FeedRequest struct {
+	Type     string // category, search or user
+	Category string
+	Genre    string
+	Period   string
+	OrderBy  string
+	Keyword  string
+	User     string
+	Count    int
+	Format   string // rss or atom
+}
+
+// parseFeedRequest reads the request from the parameters like
+// "type=category&category=音乐&format=atom"
+func parseFeedRequest(values url.Values) (FeedRequest, error) {
+	req := FeedRequest{
+		Type:     values.Get("type"),
+		Category: values.Get("category"),
+		Genre:    values.Get("genre"),
+		Period:   values.Get("period"),
+		OrderBy:  values.Get("orderby"),
+		Keyword:  values.Get("keyword"),
+		User:     values.Get("user"),
+		Format:   values.Get("format"),
+	}
+	if count := values.Get("count"); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return req, fmt.Errorf("invalid count %q", count)
+		}
+		req.Count = n
+	}
+	return req.withDefaults()
+}
+
+func (req FeedRequest) withDefaults() (FeedRequest, error) {
+	if req.Type == "" {
+		switch {
+		case req.Keyword != "":
+			req.Type = "search"
+		case req.User != "":
+			req.Type = "user"
+		default:
+			req.Type = "category"
+		}
+	}
+	switch req.Type {
+	case "category":
+		if req.Period == "" {
+			req.Period = "today"
+		}
+	case "search":
+		if req.Keyword == "" {
+			return req, errors.New("missing keyword")
+		}
+		if req.Period == "" {
+			req.Period = "history"
+		}
+	case "user":
+		if req.User == "" {
+			return req, errors.New("missing user")
+		}
+	default:
+		return req, fmt.Errorf("unknown feed type %q", req.Type)
+	}
+	if req.OrderBy == "" {
+		req.OrderBy = "published"
+	}
+	if req.Count <= 0 {
+		req.Count = 20
+	}
+	if req.Count > feedMaxCount {
+		req.Count = feedMaxCount
+	}
+	switch req.Format {
+	case "":
+		req.Format = "rss"
+	case "rss", "atom":
+	default:
+		return req, fmt.Errorf("unknown feed format %q", req.Format)
+	}
+	return req, nil
+}
+
+// Feed to save the videos of a feed
+type Feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Updated time.Time
+	Videos  []VideoDetail
+}
+
+// fetchFeed gets the videos of req from Youku
+func fetchFeed(req FeedRequest) (Feed, error) {
+	feed := Feed{Link: youkuHomeLink, Updated: time.Now()}
+	wrap := func(videos []Video) []VideoDetail {
+		details := make([]VideoDetail, len(videos))
+		for i, v := range videos {
+			details[i] = VideoDetail{Video: v}
+		}
+		return details
+	}
+
+	switch req.Type {
+	case "search":
+		feed.ID = "urn:youku:feed:search:" + url.QueryEscape(req.Keyword+"/"+req.Category)
+		feed.Title = fmt.Sprintf(feedLocale.tr("%s 相关%s视频"), req.Keyword, req.Category)
+		feed.Link = sokuSearchLink + url.QueryEscape(req.Keyword)
+		videos, err := fetchVideosByKeyword(req.Keyword, req.Category, req.Period, req.OrderBy, req.Count)
+		if err != nil {
+			return feed, err
+		}
+		feed.Videos = videos
+	case "user":
+		feed.ID = "urn:youku:feed:user:" + url.QueryEscape(req.User)
+		feed.Title = fmt.Sprintf(feedLocale.tr("%s 的视频"), req.User)
+		videos, err := getVideosByUser(req.User, req.OrderBy, 1, req.Count)
+		if err != nil {
+			return feed, err
+		}
+		feed.Videos = wrap(videos)
+	default:
+		feed.ID = "urn:youku:feed:category:" + url.QueryEscape(req.Category+"/"+req.Genre+"/"+req.OrderBy)
+		feed.Title = fmt.Sprintf(feedLocale.tr("%s视频"), req.Genre+req.Category)
+		videos, err := fetchVideosByCategory(req.Category, req.Genre, req.Period, req.OrderBy, 1, req.Count)
+		if err != nil {
+			return feed, err
+		}
+		feed.Videos = wrap(videos)
+	}
+	return feed, nil
+}
+
+// parsePublished parses the time like "2015-05-01 12:00:00" of Youku
+func parsePublished(published string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", published, youkuLocation)
+	return t, err == nil
+}
+
+// videoSummary returns the description of video in feed
+func videoSummary(video VideoDetail) string {
+	summary := fmt.Sprintf("🕒%s 🔥%s", formatDuration(video.Duration), feedLocale.formatCount(video.ViewCount))
+	if video.Description != "" {
+		summary += "\n" + video.Description
+	}
+	return summary
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Category    string        `xml:"category,omitempty"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssDocument struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+// writeRSS writes feed to w as a RSS 2.0 document
+func writeRSS(w io.Writer, feed Feed) error {
+	doc := rssDocument{
+		Version:       "2.0",
+		Title:         feed.Title,
+		Link:          feed.Link,
+		Description:   feed.Title,
+		LastBuildDate: feed.Updated.Format(time.RFC1123Z),
+	}
+	for _, video := range feed.Videos {
+		item := rssItem{
+			Title:       video.Title,
+			Link:        video.Link,
+			GUID:        rssGUID{Value: video.Link, IsPermaLink: true},
+			Category:    video.Category,
+			Description: videoSummary(video),
+		}
+		if t, ok := parsePublished(video.Published); ok {
+			item.PubDate = t.Format(time.RFC1123Z)
+		}
+		if video.Thumbnail != "" {
+			item.Enclosure = &rssEnclosure{URL: video.Thumbnail, Type: "image/jpeg"}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return writeXML(w, doc)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// writeAtom writes feed to w as an Atom document
+func writeAtom(w io.Writer, feed Feed) error {
+	now := feed.Updated.Format(time.RFC3339)
+	doc := atomDocument{
+		XMLNS:   "http://www.w3.org/2005/Atom",
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: now,
+		Links:   []atomLink{{Href: feed.Link, Rel: "alternate"}},
+		Author:  "Youku",
+	}
+	for _, video := range feed.Videos {
+		entry := atomEntry{
+			ID:      "urn:youku:video:" + video.ID,
+			Title:   video.Title,
+			Updated: now,
+			Links:   []atomLink{{Href: video.Link, Rel: "alternate"}},
+			Summary: videoSummary(video),
+		}
+		if t, ok := parsePublished(video.Published); ok {
+			entry.Published = t.Format(time.RFC3339)
+			entry.Updated = entry.Published
+		}
+		if video.Thumbnail != "" {
+			entry.Links = append(entry.Links, atomLink{Href: video.Thumbnail, Rel: "enclosure", Type: "image/jpeg"})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeFeed writes feed to w in format rss or atom
+func writeFeed(w io.Writer, feed Feed, format string) error {
+	if format == "atom" {
+		return writeAtom(w, feed)
+	}
+	return writeRSS(w, feed)
+}
+
+// FeedHandler serves the feeds of the parameters in URL, like
+// "/feed?type=search&keyword=ubuntu&format=atom"
+type FeedHandler struct{}
+
+func (FeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := parseFeedRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger.Println("[FEED]", r.RemoteAddr, r.URL.RawQuery)
+
+	feed, err := fetchFeed(req)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if req.Format == "atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	}
+	if err := writeFeed(w, feed, req.Format); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// feedCommand runs "youku feed [flags]" which writes a feed to stdout or
+// serves the feeds with -serve, returns the exit code
+func feedCommand(args []string) int {
+	// keep stdout for the feed
+	logger.SetOutput(os.Stderr)
+
+	flags := flag.NewFlagSet("feed", flag.ContinueOnError)
+	params := map[string]*string{}
+	for _, name := range []string{"type", "category", "genre", "period", "orderby", "keyword", "user", "count", "format"} {
+		params[name] = flags.String(name, "", "feed "+name)
+	}
+	output := flags.String("o", "", "write the feed to file instead of stdout")
+	serve := flags.String("serve", "", "serve the feeds at address like :8080")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	values := url.Values{}
+	for name, value := range params {
+		if *value != "" {
+			values.Set(name, *value)
+		}
+	}
+
+	if *serve != "" {
+		http.Handle("/feed", FeedHandler{})
+		fmt.Fprintf(os.Stderr, "serving feeds at %s/feed\n", *serve)
+		if err := http.ListenAndServe(*serve, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	req, err := parseFeedRequest(values)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	feed, err := fetchFeed(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeFeed(w, feed, req.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeedRequest(t *testing.T) {
+	tests := []struct {
+		query string
+		want  FeedRequest
+	}{
+		{"", FeedRequest{Type: "category", Period: "today", OrderBy: "published", Count: 20, Format: "rss"}},
+		{"category=音乐&genre=流行&format=atom&count=5", FeedRequest{Type: "category", Category: "音乐", Genre: "流行", Period: "today", OrderBy: "published", Count: 5, Format: "atom"}},
+		{"keyword=ubuntu", FeedRequest{Type: "search", Keyword: "ubuntu", Period: "history", OrderBy: "published", Count: 20, Format: "rss"}},
+		{"user=123&orderby=view-count", FeedRequest{Type: "user", User: "123", OrderBy: "view-count", Count: 20, Format: "rss"}},
+		{"count=1000", FeedRequest{Type: "category", Period: "today", OrderBy: "published", Count: feedMaxCount, Format: "rss"}},
+		{"count=-1", FeedRequest{Type: "category", Period: "today", OrderBy: "published", Count: 20, Format: "rss"}},
+	}
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		got, err := parseFeedRequest(values)
+		if err != nil {
+			t.Errorf("parseFeedRequest(%q): %v", test.query, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseFeedRequest(%q) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseFeedRequestErrors(t *testing.T) {
+	for _, query := range []string{
+		"count=abc",
+		"type=search",
+		"type=user",
+		"type=playlist",
+		"format=json",
+	} {
+		values, _ := url.ParseQuery(query)
+		if req, err := parseFeedRequest(values); err == nil {
+			t.Errorf("parseFeedRequest(%q) = %+v, want error", query, req)
+		}
+	}
+}
+
+func TestParsePublished(t *testing.T) {
+	published, ok := parsePublished("2015-05-01 12:00:00")
+	if !ok {
+		t.Fatal("parsePublished failed")
+	}
+	if got, want := published.UTC(), time.Date(2015, 5, 1, 4, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("parsePublished = %v, want %v", got, want)
+	}
+	if got, want := published.Format(time.RFC1123Z), "Fri, 01 May 2015 12:00:00 +0800"; got != want {
+		t.Errorf("RFC1123Z = %q, want %q", got, want)
+	}
+	if got, want := published.Format(time.RFC3339), "2015-05-01T12:00:00+08:00"; got != want {
+		t.Errorf("RFC3339 = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"", "2015-05-01", "2015/05/01 12:00:00", "bad"} {
+		if _, ok := parsePublished(bad); ok {
+			t.Errorf("parsePublished(%q) ok", bad)
+		}
+	}
+}
+
+func testFeed() Feed {
+	first := VideoDetail{Description: "第一集"}
+	first.ID = "XMTIz"
+	first.Title = "Ubuntu & Go"
+	first.Link = "http://v.youku.com/v_show/id_XMTIz.html"
+	first.Thumbnail = "http://r1.ykimg.com/1.jpg"
+	first.Duration = 125
+	first.ViewCount = 12345
+	first.Category = "科技"
+	first.Published = "2015-05-01 12:00:00"
+
+	// no thumbnail and a bad published time
+	second := VideoDetail{}
+	second.ID = "XNDU2"
+	second.Title = "<b>"
+	second.Link = "http://v.youku.com/v_show/id_XNDU2.html"
+	second.Duration = 59
+	second.ViewCount = 9
+	second.Published = "bad"
+
+	return Feed{
+		ID:      "urn:youku:feed:test",
+		Title:   "测试",
+		Link:    youkuHomeLink,
+		Updated: time.Date(2015, 5, 2, 8, 0, 0, 0, time.UTC),
+		Videos:  []VideoDetail{first, second},
+	}
+}
+
+const rssGolden = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>测试</title>
+    <link>http://www.youku.com/</link>
+    <description>测试</description>
+    <lastBuildDate>Sat, 02 May 2015 08:00:00 +0000</lastBuildDate>
+    <item>
+      <title>Ubuntu &amp; Go</title>
+      <link>http://v.youku.com/v_show/id_XMTIz.html</link>
+      <guid isPermaLink="true">http://v.youku.com/v_show/id_XMTIz.html</guid>
+      <pubDate>Fri, 01 May 2015 12:00:00 +0800</pubDate>
+      <category>科技</category>
+      <description>🕒2:05 🔥1.23万&#xA;第一集</description>
+      <enclosure url="http://r1.ykimg.com/1.jpg" length="0" type="image/jpeg"></enclosure>
+    </item>
+    <item>
+      <title>&lt;b&gt;</title>
+      <link>http://v.youku.com/v_show/id_XNDU2.html</link>
+      <guid isPermaLink="true">http://v.youku.com/v_show/id_XNDU2.html</guid>
+      <description>🕒0:59 🔥9</description>
+    </item>
+  </channel>
+</rss>
+`
+
+const atomGolden = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:youku:feed:test</id>
+  <title>测试</title>
+  <updated>2015-05-02T08:00:00Z</updated>
+  <link href="http://www.youku.com/" rel="alternate"></link>
+  <author>
+    <name>Youku</name>
+  </author>
+  <entry>
+    <id>urn:youku:video:XMTIz</id>
+    <title>Ubuntu &amp; Go</title>
+    <updated>2015-05-01T12:00:00+08:00</updated>
+    <published>2015-05-01T12:00:00+08:00</published>
+    <link href="http://v.youku.com/v_show/id_XMTIz.html" rel="alternate"></link>
+    <link href="http://r1.ykimg.com/1.jpg" rel="enclosure" type="image/jpeg"></link>
+    <summary>🕒2:05 🔥1.23万&#xA;第一集</summary>
+  </entry>
+  <entry>
+    <id>urn:youku:video:XNDU2</id>
+    <title>&lt;b&gt;</title>
+    <updated>2015-05-02T08:00:00Z</updated>
+    <link href="http://v.youku.com/v_show/id_XNDU2.html" rel="alternate"></link>
+    <summary>🕒0:59 🔥9</summary>
+  </entry>
+</feed>
+`
+
+func TestWriteFeed(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"rss", rssGolden},
+		{"atom", atomGolden},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeFeed(&buf, testFeed(), test.format); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", test.format, got, test.want)
+		}
+	}
+}
+
+// The feeds fail instead of being empty when Youku fails
+func TestFetchFeedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "by_keyword") {
+			// Youku reports errors in the body
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"code": 1002, "type": "InvalidParameter", "description": "keyword"}}`)
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	api := baseAPI
+	baseAPI = server.URL + "/"
+	defer func() { baseAPI = api }()
+
+	for _, query := range []string{"category=音乐", "keyword=ubuntu", "user=123"} {
+		values, _ := url.ParseQuery(query)
+		req, err := parseFeedRequest(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed, err := fetchFeed(req); err == nil {
+			t.Errorf("fetchFeed(%q) = %d videos, want error", query, len(feed.Videos))
+		}
+
+		w := httptest.NewRecorder()
+		FeedHandler{}.ServeHTTP(w, httptest.NewRequest("GET", "/feed?"+query, nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("FeedHandler(%q) = %d, want %d", query, w.Code, http.StatusBadGateway)
+		}
+	}
+
+	values, _ := url.ParseQuery("keyword=ubuntu")
+	req, _ := parseFeedRequest(values)
+	if _, err := fetchFeed(req); err == nil || !strings.Contains(err.Error(), "InvalidParameter") {
+		t.Errorf("fetchFeed error %v, want the error of Youku", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FlexInt is an integer in Youku API, which may be a number, a numeric
+// string like "1,234" or empty
+type FlexInt int64
+
+// UnmarshalJSON decodes number, numeric string and empty value to FlexInt
+func (i *FlexInt) UnmarshalJSON(data []byte) error {
+	*i = FlexInt(math.Floor(parseFlexNumber(data) + 0.5))
+	return nil
+}
+
+// FlexFloat is a float in Youku API, which may be a number, a numeric
+// string like "8.5" or empty
+type FlexFloat float64
+
+// UnmarshalJSON decodes number, numeric string and empty value to FlexFloat
+func (f *FlexFloat) UnmarshalJSON(data []byte) error {
+	*f = FlexFloat(parseFlexNumber(data))
+	return nil
+}
+
+// parseFlexNumber returns 0 for null, empty and the values which are not
+// numbers like "-". An error would abort decoding the whole response, so
+// the bad values are only logged.
+func parseFlexNumber(data []byte) float64 {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return 0
+	}
+
+	var f float64
+	if data[0] != '"' {
+		if err := json.Unmarshal(data, &f); err != nil {
+			logger.Println("[ERROR]", "flex number", string(data))
+			return 0
+		}
+		return f
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		logger.Println("[ERROR]", "flex number", string(data))
+		return 0
+	}
+	s = strings.Replace(strings.TrimSpace(s), ",", "", -1)
+	if s == "" || s == "-" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		logger.Println("[ERROR]", "flex number", string(data))
+		return 0
+	}
+	return f
+}
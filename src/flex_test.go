@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexInt(t *testing.T) {
+	tests := []struct {
+		data string
+		want FlexInt
+	}{
+		{`1234`, 1234},
+		{`"1234"`, 1234},
+		{`"1,234"`, 1234},
+		{`"1,234,567"`, 1234567},
+		{`" 42 "`, 42},
+		{`""`, 0},
+		{`null`, 0},
+		{`-3`, -3},
+		{`2.4`, 2},
+		{`2.5`, 3},
+		{`"8.6"`, 9},
+		{`1e3`, 1000},
+	}
+	for _, test := range tests {
+		var i FlexInt
+		if err := json.Unmarshal([]byte(test.data), &i); err != nil {
+			t.Errorf("FlexInt %s: %v", test.data, err)
+			continue
+		}
+		if i != test.want {
+			t.Errorf("FlexInt %s = %d, want %d", test.data, i, test.want)
+		}
+	}
+}
+
+func TestFlexFloat(t *testing.T) {
+	tests := []struct {
+		data string
+		want FlexFloat
+	}{
+		{`8.5`, 8.5},
+		{`"8.5"`, 8.5},
+		{`"1,234.5"`, 1234.5},
+		{`7`, 7},
+		{`""`, 0},
+		{`null`, 0},
+	}
+	for _, test := range tests {
+		var f FlexFloat
+		if err := json.Unmarshal([]byte(test.data), &f); err != nil {
+			t.Errorf("FlexFloat %s: %v", test.data, err)
+			continue
+		}
+		if f != test.want {
+			t.Errorf("FlexFloat %s = %v, want %v", test.data, f, test.want)
+		}
+	}
+}
+
+// The values which are not numbers are 0 instead of errors
+func TestFlexInvalid(t *testing.T) {
+	for _, data := range []string{`"abc"`, `"-"`, `"12abc"`, `true`, `[1]`, `{}`} {
+		var i FlexInt = 1
+		if err := json.Unmarshal([]byte(data), &i); err != nil || i != 0 {
+			t.Errorf("FlexInt %s = %d, %v, want 0", data, i, err)
+		}
+		var f FlexFloat = 1
+		if err := json.Unmarshal([]byte(data), &f); err != nil || f != 0 {
+			t.Errorf("FlexFloat %s = %v, %v, want 0", data, f, err)
+		}
+	}
+}
+
+// One bad count does not lose the other items of a result page
+func TestFlexInList(t *testing.T) {
+	data := `{"total": "3", "shows": [
+		{"id": "1", "name": "甲", "view_count": "1,234", "score": "8.5"},
+		{"id": "2", "name": "乙", "view_count": "-", "score": "abc"},
+		{"id": "3", "name": "丙", "view_count": 56, "score": null}
+	]}`
+	var page struct {
+		Total FlexInt
+		Shows []Show `json:"shows"`
+	}
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Shows) != 3 {
+		t.Fatalf("page = %+v", page)
+	}
+	counts := []FlexInt{1234, 0, 56}
+	for i, show := range page.Shows {
+		if show.ViewCount != counts[i] {
+			t.Errorf("show %s: view_count %d, want %d", show.ID, show.ViewCount, counts[i])
+		}
+	}
+	if page.Shows[0].Score != 8.5 || page.Shows[1].Score != 0 {
+		t.Errorf("scores %v %v", page.Shows[0].Score, page.Shows[1].Score)
+	}
+}
+
+// A field keeps working in a struct decoded from the API
+func TestFlexInStruct(t *testing.T) {
+	var user User
+	data := `{"id": "12,345", "name": "优酷", "videos_count": "", "followers_count": null}`
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 12345 || user.VideosCount != 0 {
+		t.Errorf("user = %+v", user)
+	}
+}
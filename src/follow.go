@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	followFile          = "/follow.json"
+	followCheckInterval = 30 * time.Minute
+	// Number of the shows checked at the same time
+	followCheckConcurrency = 4
+)
+
+var errNoShow = errors.New("show not found")
+
+var (
+	// followMutex guards the follow file against the background check
+	followMutex    sync.Mutex
+	followChecking bool
+)
+
+// FollowedShow to save a show followed by user
+type FollowedShow struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Thumbnail      string  `json:"thumbnail"`
+	Link           string  `json:"link"`
+	Category       string  `json:"category"`
+	Genre          string  `json:"genre"`
+	EpisodeCount   FlexInt `json:"episode_count"`
+	EpisodeUpdated FlexInt `json:"episode_updated"`
+	EpisodeSeen    FlexInt `json:"episode_seen"`
+}
+
+// HasUpdate reports whether new episodes came out since user last saw the show
+func (s FollowedShow) HasUpdate() bool {
+	return s.EpisodeUpdated > s.EpisodeSeen
+}
+
+type followData struct {
+	Checked int64          `json:"checked"`
+	Shows   []FollowedShow `json:"shows"`
+}
+
+func loadFollowData(path string) followData {
+	var data followData
+
+	f, err := ioutil.ReadFile(path + followFile)
+	if err != nil {
+		return data
+	}
+
+	err = json.Unmarshal(f, &data)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+	}
+	return data
+}
+
+func saveFollowData(path string, data followData) {
+	f, err := json.Marshal(data)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	err = ioutil.WriteFile(path+followFile, f, 0644)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+func getFollowedShows(path string) []FollowedShow {
+	followMutex.Lock()
+	defer followMutex.Unlock()
+	return loadFollowData(path).Shows
+}
+
+func isFollowed(path, showID string) bool {
+	for _, v := range getFollowedShows(path) {
+		if v.ID == showID {
+			return true
+		}
+	}
+	return false
+}
+
+// followShow adds show to the followed shows, a show which failed to be
+// fetched is not saved
+func followShow(path string, show ShowDetail) error {
+	if show.ID == "" {
+		return errNoShow
+	}
+
+	followMutex.Lock()
+	defer followMutex.Unlock()
+
+	data := loadFollowData(path)
+	for _, v := range data.Shows {
+		if v.ID == show.ID {
+			return nil
+		}
+	}
+	data.Shows = append([]FollowedShow{{
+		ID:             show.ID,
+		Name:           show.Name,
+		Thumbnail:      show.Thumbnail,
+		Link:           show.Link,
+		Category:       show.Category,
+		Genre:          firstGenre(show.Genre),
+		EpisodeCount:   show.EpisodeCount,
+		EpisodeUpdated: show.EpisodeUpdated,
+		EpisodeSeen:    show.EpisodeUpdated,
+	}}, data.Shows...)
+	saveFollowData(path, data)
+	return nil
+}
+
+func unfollowShow(path, showID string) {
+	followMutex.Lock()
+	defer followMutex.Unlock()
+
+	data := loadFollowData(path)
+	shows := []FollowedShow{}
+	for _, v := range data.Shows {
+		if v.ID != showID {
+			shows = append(shows, v)
+		}
+	}
+	data.Shows = shows
+	saveFollowData(path, data)
+}
+
+// markFollowedShowSeen records the latest episode of show as seen by user
+func markFollowedShowSeen(path string, show ShowDetail) {
+	followMutex.Lock()
+	defer followMutex.Unlock()
+
+	data := loadFollowData(path)
+	for i, v := range data.Shows {
+		if v.ID == show.ID {
+			data.Shows[i].EpisodeUpdated = show.EpisodeUpdated
+			data.Shows[i].EpisodeCount = show.EpisodeCount
+			data.Shows[i].EpisodeSeen = show.EpisodeUpdated
+			saveFollowData(path, data)
+			return
+		}
+	}
+}
+
+// checkFollowUpdates refreshes the latest episodes of followed shows in
+// background, at most once in followCheckInterval. The saved episodes are
+// shown until the check is done.
+func checkFollowUpdates(path string) {
+	followMutex.Lock()
+	defer followMutex.Unlock()
+
+	data := loadFollowData(path)
+	if followChecking || len(data.Shows) == 0 || time.Since(time.Unix(data.Checked, 0)) < followCheckInterval {
+		return
+	}
+	followChecking = true
+	go refreshFollowedShows(path, data.Shows)
+}
+
+// refreshFollowedShows gets the details of shows, followCheckConcurrency at
+// a time, and saves their latest episodes
+func refreshFollowedShows(path string, shows []FollowedShow) {
+	logger.Println("[FOLLOW] check updates", len(shows))
+
+	details := make([]ShowDetail, len(shows))
+	var wg sync.WaitGroup
+	slots := make(chan bool, followCheckConcurrency)
+	for i, v := range shows {
+		if v.ID == "" {
+			continue
+		}
+		wg.Add(1)
+		slots <- true
+		go func(i int, id string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			details[i] = getShowDetail(id)
+		}(i, v.ID)
+	}
+	wg.Wait()
+
+	followMutex.Lock()
+	defer followMutex.Unlock()
+	followChecking = false
+
+	// the shows may be followed or unfollowed during the check
+	updated := map[string]ShowDetail{}
+	for _, show := range details {
+		if show.ID != "" {
+			updated[show.ID] = show
+		}
+	}
+	data := loadFollowData(path)
+	kept := []FollowedShow{}
+	for _, v := range data.Shows {
+		// drop the shows saved without ID by older versions
+		if v.ID == "" {
+			continue
+		}
+		if show, ok := updated[v.ID]; ok {
+			v.EpisodeUpdated = show.EpisodeUpdated
+			v.EpisodeCount = show.EpisodeCount
+		}
+		kept = append(kept, v)
+	}
+	data.Shows = kept
+	data.Checked = time.Now().Unix()
+	saveFollowData(path, data)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	historyFile    = "/history.json"
+	historyMaxSize = 100
+)
+
+// historyMutex guards the history file against concurrent queries
+var historyMutex sync.Mutex
+
+// HistoryItem to save a video or show opened from the scope
+type HistoryItem struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	Thumbnail string  `json:"thumbnail"`
+	Link      string  `json:"link"`
+	Category  string  `json:"category,omitempty"`
+	Genre     string  `json:"genre,omitempty"`
+	Episode   FlexInt `json:"episode,omitempty"`
+	Watched   int64   `json:"watched"`
+}
+
+func getHistory(path string) []HistoryItem {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	return loadHistory(path)
+}
+
+func loadHistory(path string) []HistoryItem {
+	f, err := ioutil.ReadFile(path + historyFile)
+	if err != nil {
+		return []HistoryItem{}
+	}
+
+	var items []HistoryItem
+	err = json.Unmarshal(f, &items)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []HistoryItem{}
+	}
+	return items
+}
+
+func saveHistory(path string, items []HistoryItem) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	// the queries never read a half written history
+	tmp := path + historyFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	if err := os.Rename(tmp, path+historyFile); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// addHistory puts item on top of the history, replacing an older entry of
+// the same video or show
+func addHistory(path string, item HistoryItem) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	item.Watched = time.Now().Unix()
+
+	items := []HistoryItem{item}
+	for _, v := range loadHistory(path) {
+		if v.Type == item.Type && v.ID == item.ID {
+			continue
+		}
+		items = append(items, v)
+	}
+	if len(items) > historyMaxSize {
+		items = items[:historyMaxSize]
+	}
+	saveHistory(path, items)
+}
+
+func removeHistory(path, itemType, id string) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	items := []HistoryItem{}
+	for _, v := range loadHistory(path) {
+		if v.Type == itemType && v.ID == id {
+			continue
+		}
+		items = append(items, v)
+	}
+	saveHistory(path, items)
+}
+
+func clearHistory(path string) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	saveHistory(path, []HistoryItem{})
+}
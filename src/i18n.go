@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Catalog to save the translations of a locale, from msgid to msgstr
+type Catalog map[string]string
+
+// Locale to translate the UI strings of a query. The zero Locale is
+// Chinese, in which the UI strings are written.
+type Locale struct {
+	Name    string
+	Catalog Catalog
+}
+
+var (
+	catalogs      = map[string]Catalog{}
+	catalogsMutex sync.Mutex
+)
+
+// getLocale returns the Locale of locale like "en_US". There is nothing to
+// translate for Chinese locales, and the English catalog is used for the
+// locales without a catalog. The catalogs are loaded once and never
+// changed, so they are shared by the queries.
+func getLocale(path, locale string) Locale {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	language := strings.SplitN(locale, "_", 2)[0]
+	if language == "zh" || language == "" {
+		return Locale{Name: locale}
+	}
+
+	catalogsMutex.Lock()
+	defer catalogsMutex.Unlock()
+
+	for _, name := range []string{locale, language, "en"} {
+		c, ok := catalogs[name]
+		if !ok {
+			c = loadCatalog(path + "/data/locale/" + name + ".po")
+			catalogs[name] = c
+		}
+		if c != nil {
+			return Locale{Name: locale, Catalog: c}
+		}
+	}
+	return Locale{Name: locale}
+}
+
+// isChinese reports whether l is Chinese
+func (l Locale) isChinese() bool {
+	return l.Name == "" || strings.HasPrefix(l.Name, "zh")
+}
+
+// tr translates msgid to l
+func (l Locale) tr(msgid string) string {
+	if msgstr, ok := l.Catalog[msgid]; ok && msgstr != "" {
+		return msgstr
+	}
+	return msgid
+}
+
+// termLabel turns a category term like "fashion-drama" to a label like
+// "Fashion Drama" for the locales other than Chinese
+func termLabel(term string) string {
+	words := strings.FieldsFunc(term, func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	})
+	for i, w := range words {
+		runes := []rune(w)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// loadCatalog parses a gettext PO file, returns nil if it does not exist
+func loadCatalog(file string) Catalog {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	c := Catalog{}
+	var msgid, msgstr string
+	var current *string
+
+	add := func() {
+		if msgid != "" {
+			c[msgid] = msgstr
+		}
+		msgid, msgstr = "", ""
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "msgid "):
+			add()
+			current = &msgid
+			line = strings.TrimPrefix(line, "msgid ")
+		case strings.HasPrefix(line, "msgstr "):
+			current = &msgstr
+			line = strings.TrimPrefix(line, "msgstr ")
+		}
+		if current == nil {
+			continue
+		}
+		s, err := strconv.Unquote(line)
+		if err != nil {
+			logger.Println("[ERROR]", file, err)
+			continue
+		}
+		*current += s
+	}
+	add()
+
+	if err := scanner.Err(); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+	return c
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGetLocale(t *testing.T) {
+	tests := []struct {
+		locale  string
+		chinese bool
+		want    string
+	}{
+		{"zh_CN.UTF-8", true, "已下载"},
+		{"", true, "已下载"},
+		{"en_US.UTF-8", false, "Downloads"},
+		// the English catalog for the locales without a catalog
+		{"fr_FR", false, "Downloads"},
+	}
+	for _, test := range tests {
+		l := getLocale("..", test.locale)
+		if l.isChinese() != test.chinese {
+			t.Errorf("getLocale(%q).isChinese() = %v", test.locale, l.isChinese())
+		}
+		if got := l.tr("已下载"); got != test.want {
+			t.Errorf("getLocale(%q).tr = %q, want %q", test.locale, got, test.want)
+		}
+	}
+}
+
+// The queries in different locales at the same time get their own strings
+func TestLocaleConcurrentQueries(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		locale, want := "en_US", "Downloads"
+		if i%2 == 0 {
+			locale, want = "zh_CN", "已下载"
+		}
+		wg.Add(1)
+		go func(locale, want string) {
+			defer wg.Done()
+			l := getLocale("..", locale)
+			for j := 0; j < 100; j++ {
+				if got := l.tr("已下载"); got != want {
+					t.Errorf("%s: tr = %q, want %q", locale, got, want)
+					return
+				}
+			}
+		}(locale, want)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HomeSection to save a section of home page
+type HomeSection struct {
+	Type        string `json:"type"` // video, show, recommend, random or local
+	Category    string `json:"category"`
+	Genre       string `json:"genre"`
+	Area        string `json:"area"` // shows only
+	OrderBy     string `json:"orderby"`
+	Period      string `json:"period"`
+	Count       int    `json:"count"`
+	Template    string `json:"template"` // carousel, grid or large
+	Random      bool   `json:"-"`
+	Recommended bool   `json:"-"`
+}
+
+// getHomeLayout returns the sections of home page. The layout from settings
+// is used if it is not empty, otherwise the default one in data/home.json.
+func getHomeLayout(path, layout string) []HomeSection {
+
+	if sections := parseHomeLayout(layout); len(sections) > 0 {
+		return sections
+	}
+
+	f, err := ioutil.ReadFile(path + "/data/home.json")
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []HomeSection{}
+	}
+
+	var data struct {
+		Sections []HomeSection `json:"sections"`
+	}
+
+	err = json.Unmarshal(f, &data)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []HomeSection{}
+	}
+	for i := range data.Sections {
+		data.Sections[i] = data.Sections[i].withDefaults()
+	}
+	return data.Sections
+}
+
+// parseHomeLayout parses the layout in settings. Sections are separated by
+// ";", fields of a section are separated by "," in the order of
+// type,category,genre,orderby,period,count,template
+// e.g. "show,电视剧,,view-today-count,,10,carousel;video,音乐"
+func parseHomeLayout(layout string) []HomeSection {
+	sections := []HomeSection{}
+
+	for _, s := range strings.Split(layout, ";") {
+		fields := strings.Split(strings.TrimSpace(s), ",")
+		for len(fields) < 7 {
+			fields = append(fields, "")
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		section := HomeSection{
+			Type:     fields[0],
+			Category: fields[1],
+			Genre:    fields[2],
+			OrderBy:  fields[3],
+			Period:   fields[4],
+			Template: fields[6],
+		}
+		switch section.Type {
+		case "video", "show", "recommend", "random", "local":
+		default:
+			if section.Type != "" {
+				logger.Println("[ERROR] unknown home section:", s)
+			}
+			continue
+		}
+		section.Count, _ = strconv.Atoi(fields[5])
+		sections = append(sections, section.withDefaults())
+	}
+
+	return sections
+}
+
+func (s HomeSection) withDefaults() HomeSection {
+	if s.Count <= 0 {
+		s.Count = 10
+	}
+	if s.Template == "" {
+		s.Template = "grid"
+	}
+	switch s.Type {
+	case "video":
+		if s.OrderBy == "" {
+			s.OrderBy = "view-count"
+		}
+		if s.Period == "" {
+			s.Period = "today"
+		}
+	case "show":
+		if s.OrderBy == "" {
+			s.OrderBy = "view-today-count"
+		}
+	}
+	return s
+}
+
+// randomHomeSection picks a category of videos or shows randomly
+func randomHomeSection(categories *CategoryRegistry) HomeSection {
+	rand.Seed(time.Now().UnixNano())
+
+	section := HomeSection{Random: true, Template: "grid", Type: "video"}
+	if rand.Intn(2) == 1 {
+		section.Type = "show"
+	}
+
+	candidates := []Category{}
+	for _, c := range categories.Categories(section.Type) {
+		if section.Type == "show" && c.Label == "音乐" {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) == 0 {
+		section.Type = ""
+		return section
+	}
+	section.Category = candidates[rand.Intn(len(candidates))].Label
+	return section.withDefaults()
+}
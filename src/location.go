@@ -0,0 +1,109 @@
+package main
+
+import (
+	"launchpad.net/go-unityscopes/v2"
+	"strings"
+	"unicode"
+)
+
+// countryAreas maps the country codes to the areas of shows in Youku
+var countryAreas = map[string]string{
+	"CN": "大陆",
+	"HK": "香港",
+	"MO": "香港",
+	"TW": "台湾",
+	"JP": "日本",
+	"KR": "韩国",
+	"TH": "泰国",
+	"IN": "印度",
+	"US": "美国",
+	"GB": "英国",
+	"FR": "法国",
+	"DE": "德国",
+}
+
+// cityNames maps the English names of cities from location service to the
+// Chinese names, which are used to search local news
+var cityNames = map[string]string{
+	"beijing":   "北京",
+	"shanghai":  "上海",
+	"guangzhou": "广州",
+	"shenzhen":  "深圳",
+	"tianjin":   "天津",
+	"chongqing": "重庆",
+	"chengdu":   "成都",
+	"hangzhou":  "杭州",
+	"nanjing":   "南京",
+	"wuhan":     "武汉",
+	"xian":      "西安",
+	"xi'an":     "西安",
+	"suzhou":    "苏州",
+	"changsha":  "长沙",
+	"shenyang":  "沈阳",
+	"qingdao":   "青岛",
+	"zhengzhou": "郑州",
+	"dalian":    "大连",
+	"xiamen":    "厦门",
+	"jinan":     "济南",
+	"harbin":    "哈尔滨",
+	"fuzhou":    "福州",
+	"kunming":   "昆明",
+	"hefei":     "合肥",
+	"nanning":   "南宁",
+	"hong kong": "香港",
+	"macau":     "澳门",
+	"taipei":    "台北",
+}
+
+// userLocation returns the location of user, nil if it is disabled in
+// settings or not available
+func (sc *YoukuScope) userLocation(metadata *scopes.SearchMetadata) *scopes.Location {
+	if !sc.ScopeSettings.UseLocation {
+		return nil
+	}
+	location, err := metadata.Location()
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return nil
+	}
+	return location
+}
+
+// localName returns the name of city (or region) of location to search
+// local content
+func localName(location *scopes.Location) string {
+	if location == nil {
+		return ""
+	}
+	for _, name := range []string{location.City, location.RegionName} {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if isHan(name) {
+			return name
+		}
+		if n, ok := cityNames[strings.ToLower(name)]; ok {
+			return n
+		}
+		return name
+	}
+	return ""
+}
+
+// localArea returns the area of shows of location, like "大陆"
+func localArea(location *scopes.Location) string {
+	if location == nil {
+		return ""
+	}
+	return countryAreas[strings.ToUpper(location.CountryCode)]
+}
+
+func isHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,7 +7,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -20,95 +20,6 @@ const (
 	accountProvider    = packageName + "_account-plugin"
 )
 
-const (
-	homeCategoryTemplate = `{
-		"schema-version": 1,
-		"template": {
-			"category-layout": "carousel",
-			"card-size": "large",
-			"overlay": true
-		},
-		"components": {
-			"title": "title",
-			"subtitle": "subtitle",
-			"art": {
-				"field": "art",
-				"aspect-ratio": 1.4
-			},
-			"attributes": "attributes"
-		}
-	}`
-
-	custormVideoCategoryTemplate = `{
-		"schema-verion": 1,
-		"template": {
-			"category-layout": "grid",
-			"card-size": "%s"
-		},
-		"components": {
-			"title": "title",
-			"subtitle": "subtitle",
-			"art": {
-				"field": "art",
-				"aspect-ratio": 1.5
-			},
-			"attributes": "attributes"
-		}
-	}`
-
-	largeVideoCategoryTemplate = `{
-		"schema-verion": 1,
-		"template": {
-			"category-layout": "vertical-journal",
-			"card-size": "large",
-			"overlay": true
-		},
-		"components": {
-			"title": "title",
-			"subtitle": "subtitle",
-			"art": {
-				"field": "art",
-				"aspect-ratio": 2.5
-			},
-			"attributes": "attributes"
-		}
-	}`
-
-	loginNagTemplate = `{
-		"schema-version": 1,
-		"template": {
-			"category-layout": "vertical-journal",
-			"card-size": "large",
-			"card-background": "color:///#06A7E1"
-		},
-		"components": {
-			"title": "title",
-			"art" : {
-				"aspect-ratio": 100.0
-			}
-		}
-	}`
-
-	queryVideoTemplate = `{
-		"schema-version": 1,
-		"template": {
-			"category-layout": "grid",
-			"card-layout": "horizontal",
-			"card-size": "small"
-		},
-		"components": {
-			"title": "title",
-			"subtitle": "subtitle",
-			"art": {
-				"field": "art",
-				"fill-mode": "fit",
-				"aspect-ratio": 1.5
-			},
-			"attributes": "attributes"
-		}
-	}`
-)
-
 var itemSize = "medium"
 var logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
 
@@ -116,6 +27,12 @@ type settings struct {
 	ResultCount  float64 `json:"result_count"`
 	ItemSize     int     `json:"item_size"`
 	CommentCount float64 `json:"comment_count"`
+	HomeLayout   string  `json:"home_layout"`
+	HomeRandom   bool    `json:"home_random"`
+	Quality      int     `json:"preferred_quality"`
+	UseLocation  bool    `json:"use_location"`
+	WiFiOnly     bool    `json:"download_wifi_only"`
+	Quota        float64 `json:"download_quota"`
 }
 
 // YoukuScope for Ubuntu Touch
@@ -123,25 +40,56 @@ type YoukuScope struct {
 	Accounts      *accounts.Watcher
 	base          *scopes.ScopeBase
 	ScopeSettings *settings
+	categories    *CategoryRegistry
+	aggregation   []AggregationRule
+	Resolver      StreamResolver
+	downloads     *DownloadManager
+	stats         *StatsStore
+	exports       *PlaylistExports
+	locale        Locale
 }
 
 // SetScopeBase to set the ScopeBase including settings and various directories available for use
 func (sc *YoukuScope) SetScopeBase(base *scopes.ScopeBase) {
 	sc.base = base
+	paidEmblem = base.ScopeDirectory() + "/data/paid.svg"
+	sc.categories = NewCategoryRegistry(base.ScopeDirectory(), base.CacheDirectory())
+	sc.aggregation = getAggregationRules(base.ScopeDirectory())
+	checkAggregationKeywords(base.ScopeDirectory(), sc.aggregation)
+	sc.downloads = NewDownloadManager(base.CacheDirectory())
+	sc.stats = NewStatsStore(base.CacheDirectory())
+	sc.exports = NewPlaylistExports()
 }
 
-// Search to display items
-func (sc *YoukuScope) Search(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply, cancelled <-chan bool) error {
-
-	// Get Settings
+func (sc *YoukuScope) loadSettings() {
 	var s settings
 	err := sc.base.Settings(&s)
 	if err != nil {
 		logger.Println("[ERROR]", err)
-		sc.ScopeSettings = &settings{50, 1, 20}
+		sc.ScopeSettings = &settings{ResultCount: 50, ItemSize: 1, CommentCount: 20, UseLocation: true, WiFiOnly: true, Quota: 2048}
 	} else {
 		sc.ScopeSettings = &s
 	}
+	if sc.downloads != nil {
+		sc.downloads.Configure(sc.ScopeSettings.WiFiOnly, sc.ScopeSettings.Quota)
+	}
+}
+
+// forQuery returns a copy of the scope with the settings and locale of a
+// query, which are not shared with the other queries
+func (sc *YoukuScope) forQuery(locale string) *YoukuScope {
+	query := *sc
+	query.loadSettings()
+	query.locale = getLocale(sc.base.ScopeDirectory(), locale)
+	return &query
+}
+
+// Search to display items
+func (sc *YoukuScope) Search(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply, cancelled <-chan bool) error {
+
+	// Get Settings
+	sc = sc.forQuery(metadata.Locale())
+	defer sc.stats.Flush()
 
 	// Parse Settings
 	switch sc.ScopeSettings.ItemSize {
@@ -170,7 +118,7 @@ func (sc *YoukuScope) Search(query *scopes.CannedQuery, metadata *scopes.SearchM
 		logger.Println("[ERROR] Could not account data: ", err)
 	}
 	if service == nil {
-		cat := reply.RegisterCategory("nag", "", "", loginNagTemplate)
+		cat := reply.RegisterCategory("nag", "", "", loginNagTemplate.JSON())
 		result := scopes.NewCategorisedResult(cat)
 		result.SetTitle("Log-in")
 		scopes.RegisterAccountLoginResult(result, query, accountService, accountServiceType, accountProvider, scopes.PostLoginInvalidateResults, scopes.PostLoginDoNothing)
@@ -183,23 +131,34 @@ func (sc *YoukuScope) Search(query *scopes.CannedQuery, metadata *scopes.SearchM
 	// Create departments
 	reply.RegisterDepartments(sc.createDepartment(query, metadata, reply))
 
+	department := ParseDepartmentID(departmentID)
+
 	if queryString == "" {
-		switch {
-		case strings.HasPrefix(departmentID, "home"), departmentID == "":
-			sc.showHome(query, metadata, reply)
-		case strings.HasPrefix(departmentID, "video"):
+		switch department.Kind {
+		case "history":
+			sc.showHistory(query, metadata, reply)
+		case "follow":
+			sc.showFollow(query, metadata, reply)
+		case "downloads":
+			sc.showDownloads(query, metadata, reply)
+		case "video":
 			sc.showVideos(query, metadata, reply)
-		case strings.HasPrefix(departmentID, "show"):
+		case "show":
 			sc.showShows(query, metadata, reply)
+		default:
+			sc.showHome(query, metadata, reply)
 		}
 	} else {
-		switch {
-		case strings.HasPrefix(departmentID, "home"), departmentID == "":
+		searchCategory, _ := sc.categories.APIValues(department)
+		addSearchTerm(sc.base.CacheDirectory(), queryString, searchCategory)
+
+		switch department.Kind {
+		case "video":
 			sc.queryVideo(queryString, departmentID, reply)
+		case "show":
 			sc.queryShow(queryString, departmentID, reply)
-		case strings.HasPrefix(departmentID, "video"):
+		default:
 			sc.queryVideo(queryString, departmentID, reply)
-		case strings.HasPrefix(departmentID, "show"):
 			sc.queryShow(queryString, departmentID, reply)
 		}
 	}
@@ -211,46 +170,181 @@ func (sc *YoukuScope) Search(query *scopes.CannedQuery, metadata *scopes.SearchM
 func (sc *YoukuScope) Preview(result *scopes.Result, metadata *scopes.ActionMetadata, reply *scopes.PreviewReply, cancelled <-chan bool) error {
 
 	// Get Settings
-	var s settings
-	err := sc.base.Settings(&s)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		sc.ScopeSettings = &settings{50, 1, 20}
-	} else {
-		sc.ScopeSettings = &s
-	}
+	sc = sc.forQuery(metadata.Locale())
+	defer sc.stats.Flush()
 
 	var previewType string
-	err = result.Get("type", &previewType)
+	err := result.Get("type", &previewType)
 	if err != nil {
 		logger.Println("[ERROR]", err)
 		return nil
 	}
 
-	logger.Println("[PREVIEW]", previewType, result.Title())
+	var id string
+	result.Get(previewType+"_id", &id)
+	fromHistory := isFromHistory(result)
+
+	// Preview the item an action asked for instead of the result
+	var target previewTarget
+	if err := metadata.ScopeData(&target); err == nil && target.ID != "" {
+		previewType, id, fromHistory = target.Type, target.ID, false
+	}
+	if previewType == "error" {
+		sc.viewError(target.Error, id, reply)
+		return nil
+	}
+
+	logger.Println("[PREVIEW]", previewType, id, result.Title())
 
 	switch previewType {
 	case "video":
-		sc.viewVideo(result, reply)
+		sc.viewVideo(id, fromHistory, reply)
 	case "show":
-		sc.viewShow(result, reply)
+		sc.viewShow(id, fromHistory, reply)
+	case "download":
+		sc.viewDownload(id, reply)
+	case "export":
+		var source PlaylistSource
+		if err := result.Get("export", &source); err != nil {
+			logger.Println("[ERROR]", err)
+			return nil
+		}
+		sc.viewExport(source, reply)
 	}
 
 	return nil
 }
 
+// Activate handles the results which intercept activation
+func (sc *YoukuScope) Activate(result *scopes.Result, metadata *scopes.ActionMetadata) (*scopes.ActivationResponse, error) {
+
+	var resultType string
+	if err := result.Get("type", &resultType); err != nil {
+		return scopes.NewActivationResponse(scopes.ActivationNotHandled), nil
+	}
+
+	logger.Println("[ACTIVATE]", resultType, result.Title())
+
+	switch resultType {
+	case "clear_history":
+		clearHistory(sc.base.CacheDirectory())
+		query := scopes.NewCannedQuery(scopeName, "", "history")
+		return scopes.NewActivationResponseForQuery(query), nil
+	}
+
+	return scopes.NewActivationResponse(scopes.ActivationNotHandled), nil
+}
+
+// PerformAction handles the actions in preview
+func (sc *YoukuScope) PerformAction(result *scopes.Result, metadata *scopes.ActionMetadata, widgetID, actionID string) (*scopes.ActivationResponse, error) {
+
+	sc = sc.forQuery(metadata.Locale())
+
+	logger.Println("[ACTION]", widgetID, actionID, result.Title())
+
+	switch actionID {
+	case "remove_history":
+		var resultType, id string
+		result.Get("type", &resultType)
+		if err := result.Get(resultType+"_id", &id); err != nil {
+			logger.Println("[ERROR]", err)
+			break
+		}
+		removeHistory(sc.base.CacheDirectory(), resultType, id)
+		query := scopes.NewCannedQuery(scopeName, "", "history")
+		return scopes.NewActivationResponseForQuery(query), nil
+	case "export_playlist":
+		var source PlaylistSource
+		if err := result.Get("export", &source); err != nil {
+			logger.Println("[ERROR]", err)
+			break
+		}
+		sc.exportPlaylist(source)
+		return scopes.NewActivationResponse(scopes.ActivationShowPreview), nil
+	}
+
+	// Actions with the ID of the video or show in preview
+	action, id := splitAction(actionID)
+	switch action {
+	case "follow":
+		if err := followShow(sc.base.CacheDirectory(), getShowDetail(id)); err != nil {
+			logger.Println("[ERROR]", "follow", id, err)
+			return showError(sc.locale.tr("加入追剧失败"), "follow:"+id), nil
+		}
+		return showPreview("show", id), nil
+	case "unfollow":
+		unfollowShow(sc.base.CacheDirectory(), id)
+		return showPreview("show", id), nil
+	case "view_show":
+		return showPreview("show", id), nil
+	case "view_video":
+		return showPreview("video", id), nil
+	case "download":
+		video := getVideoDetail(id)
+		if !video.Downloadable() {
+			logger.Println("[ERROR]", "download disabled", id)
+			return showPreview("video", id), nil
+		}
+		stream, err := pickStream(sc.Resolver, video, sc.ScopeSettings.Quality)
+		if err != nil {
+			logger.Println("[ERROR]", "resolve", id, err)
+			return showPreview("video", id), nil
+		}
+		sc.downloads.Enqueue(video, stream)
+		return showPreview("download", id), nil
+	case "view_download":
+		return showPreview("download", id), nil
+	case "remove_download":
+		sc.downloads.Remove(id)
+		query := scopes.NewCannedQuery(scopeName, "", "downloads")
+		return scopes.NewActivationResponseForQuery(query), nil
+	}
+
+	return scopes.NewActivationResponse(scopes.ActivationNotHandled), nil
+}
+
+// previewTarget to save the item to preview instead of the activated result
+type previewTarget struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+func showPreview(previewType, id string) *scopes.ActivationResponse {
+	response := scopes.NewActivationResponse(scopes.ActivationShowPreview)
+	response.ScopeData = previewTarget{Type: previewType, ID: id}
+	return response
+}
+
+// showError previews the error of an action, which can be retried by the
+// action of retryID
+func showError(message, retryID string) *scopes.ActivationResponse {
+	response := scopes.NewActivationResponse(scopes.ActivationShowPreview)
+	response.ScopeData = previewTarget{Type: "error", ID: retryID, Error: message}
+	return response
+}
+
+// splitAction splits action ID like "follow:<show_id>"
+func splitAction(actionID string) (action, id string) {
+	parts := strings.SplitN(actionID, ":", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return actionID, ""
+}
+
 func (sc *YoukuScope) showVideos(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
 
 	// create filter
 	state := query.FilterState()
 	filter := scopes.NewOptionSelectorFilter("video_orderby", "Orderby", false)
 	filter.DisplayHints = 1
-	filter.AddOption("published", "发布时间")
-	filter.AddOption("view-count", "总播放数")
-	filter.AddOption("comment-count", "总评论数")
-	filter.AddOption("reference-count", "总引用数")
-	filter.AddOption("favorite-time", "收藏时间")
-	filter.AddOption("favorite-count", "总收藏数")
+	filter.AddOption("published", sc.locale.tr("发布时间"))
+	filter.AddOption("view-count", sc.locale.tr("总播放数"))
+	filter.AddOption("comment-count", sc.locale.tr("总评论数"))
+	filter.AddOption("reference-count", sc.locale.tr("总引用数"))
+	filter.AddOption("favorite-time", sc.locale.tr("收藏时间"))
+	filter.AddOption("favorite-count", sc.locale.tr("总收藏数"))
 	if !filter.HasActiveOption(state) {
 		filter.UpdateState(state, "published", true)
 	}
@@ -262,23 +356,35 @@ func (sc *YoukuScope) showVideos(query *scopes.CannedQuery, metadata *scopes.Sea
 	}
 	reply.PushFilters([]scopes.Filter{filter}, state)
 
-	_deptIDs := strings.Split(query.DepartmentID(), "_")
-	var videoCategory, videoGenre string
-	if len(_deptIDs) == 2 {
-		videoCategory = _deptIDs[1]
-	} else if len(_deptIDs) > 2 {
-		videoCategory = _deptIDs[1]
-		videoGenre = _deptIDs[2]
+	videoCategory, videoGenre := sc.categories.APIValues(ParseDepartmentID(query.DepartmentID()))
+
+	// news of the city of user
+	if videoCategory == "资讯" && videoGenre == "" {
+		if city := localName(sc.userLocation(metadata)); city != "" {
+			logger.Println("[LOCAL NEWS]", city)
+			videos := queryVideosByKeyword(city, videoCategory, "week", "published", 10)
+			if len(videos) > 0 {
+				category := reply.RegisterCategory("local_news", fmt.Sprintf(sc.locale.tr("本地资讯 · %s"), city), "", categoryTemplate("video", videoCategory))
+				ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(videoDetailItems(videos))
+			}
+		}
 	}
 
-	category := reply.RegisterCategory("video", videoCategory+"视频", "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
+	category := reply.RegisterCategory("video", fmt.Sprintf(sc.locale.tr("%s视频"), sc.categories.Label(sc.locale, "video", videoCategory)), "", categoryTemplate("video", videoCategory))
 
 	// Get videos
 	logger.Println("[VIDEOS]", videoCategory, videoGenre, orderby)
 	videos := getVideosByCategory(videoCategory, videoGenre, "today", orderby, 1, int(sc.ScopeSettings.ResultCount))
+	sc.stats.Record(videoRankingStats(rankingName("video", videoCategory, videoGenre, orderby), videos))
 
 	// Show Videos
-	pushData(videos, category, reply)
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(videoItems(videos))
+
+	listed := make([]VideoDetail, len(videos))
+	for i, video := range videos {
+		listed[i] = VideoDetail{Video: video}
+	}
+	sc.pushExport(PlaylistSource{DepartmentID: query.DepartmentID(), OrderBy: orderby}, listed, reply)
 }
 
 func (sc *YoukuScope) showShows(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
@@ -287,14 +393,15 @@ func (sc *YoukuScope) showShows(query *scopes.CannedQuery, metadata *scopes.Sear
 	state := query.FilterState()
 	filter := scopes.NewOptionSelectorFilter("show_orderby", "Orderby", false)
 	filter.DisplayHints = 1
-	filter.AddOption("view-today-count", "今日播放数")
-	filter.AddOption("view-count", "总播放数")
-	filter.AddOption("comment-count", "总评论数")
-	filter.AddOption("favorite-count", "总收藏数")
-	filter.AddOption("view-week-count", "本周播放数")
-	filter.AddOption("release-date", "上映日期")
-	filter.AddOption("score", "评分")
-	filter.AddOption("updated", "最后更新")
+	filter.AddOption("view-today-count", sc.locale.tr("今日播放数"))
+	filter.AddOption("view-count", sc.locale.tr("总播放数"))
+	filter.AddOption("comment-count", sc.locale.tr("总评论数"))
+	filter.AddOption("favorite-count", sc.locale.tr("总收藏数"))
+	filter.AddOption("view-week-count", sc.locale.tr("本周播放数"))
+	filter.AddOption("release-date", sc.locale.tr("上映日期"))
+	filter.AddOption("score", sc.locale.tr("评分"))
+	filter.AddOption("updated", sc.locale.tr("最后更新"))
+	filter.AddOption("rising", sc.locale.tr("飙升榜"))
 	if !filter.HasActiveOption(state) {
 		filter.UpdateState(state, "view-today-count", true)
 	}
@@ -304,179 +411,339 @@ func (sc *YoukuScope) showShows(query *scopes.CannedQuery, metadata *scopes.Sear
 	if len(filterIDs) > 0 {
 		orderby = filterIDs[0]
 	}
-	reply.PushFilters([]scopes.Filter{filter}, state)
 
-	_deptIDs := strings.Split(query.DepartmentID(), "_")
-	var showCategory, showGenre string
-	if len(_deptIDs) == 1 {
+	qualityFilter := scopes.NewOptionSelectorFilter("show_quality", sc.locale.tr("清晰度"), false)
+	qualityFilter.AddOption("hd", sc.locale.tr("高清及以上"))
+	hdOnly := qualityFilter.HasActiveOption(state)
+
+	filters := []scopes.Filter{filter, qualityFilter}
+
+	// shows of the area of user
+	showArea := ""
+	if area := localArea(sc.userLocation(metadata)); area != "" {
+		areaFilter := scopes.NewOptionSelectorFilter("show_area", sc.locale.tr("地区"), false)
+		areaFilter.AddOption("local", fmt.Sprintf(sc.locale.tr("只看%s"), area))
+		if areaFilter.HasActiveOption(state) {
+			showArea = area
+		}
+		filters = append(filters, areaFilter)
+	}
+
+	reply.PushFilters(filters, state)
+
+	showCategory, showGenre := sc.categories.APIValues(ParseDepartmentID(query.DepartmentID()))
+	if showCategory == "" {
 		rand.Seed(time.Now().UnixNano())
-		showCategories := getShowCategories(sc.base.ScopeDirectory())
+		showCategories := sc.categories.Categories("show")
+		if len(showCategories) == 0 {
+			logger.Println("[ERROR]", "no show category")
+			return
+		}
 		showCategory = showCategories[rand.Intn(len(showCategories))].Label
-	} else if len(_deptIDs) == 2 {
-		showCategory = _deptIDs[1]
-	} else if len(_deptIDs) > 2 {
-		showCategory = _deptIDs[1]
-		showGenre = _deptIDs[2]
 	}
-	logger.Println("[SHOWS]", showCategory, showGenre, orderby)
-	shows := getShowsByCategory(showCategory, showGenre, orderby, 1, int(sc.ScopeSettings.ResultCount))
+	logger.Println("[SHOWS]", showCategory, showGenre, showArea, orderby)
+	var items []Renderable
+	if orderby == "rising" {
+		for _, show := range getRisingShows(sc.stats, showCategory, showGenre, showArea, risingCount) {
+			if !hdOnly || bestQuality(show.StreamTypes) >= qualityHD {
+				items = append(items, show)
+			}
+		}
+	} else {
+		shows := getShowsByCategory(showCategory, showGenre, showArea, orderby, 1, int(sc.ScopeSettings.ResultCount))
+		if showArea == "" {
+			sc.stats.Record(showRankingStats(rankingName("show", showCategory, showGenre, orderby), shows))
+		}
+		for _, show := range shows {
+			if !hdOnly || bestQuality(show.StreamTypes) >= qualityHD {
+				items = append(items, show)
+			}
+		}
+	}
 
-	category := reply.RegisterCategory("show", showCategory+"节目", "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
+	category := reply.RegisterCategory("show", fmt.Sprintf(sc.locale.tr("%s节目"), showArea+sc.categories.Label(sc.locale, "show", showCategory)), "", categoryTemplate("show", showCategory))
 
 	// Show shows
-	pushData(shows, category, reply)
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
 }
 
 func (sc *YoukuScope) showHome(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
 
 	logger.Println("--SHOW HOME--")
-	rand.Seed(time.Now().UnixNano())
-	videoCatgories := getVideoCategories(sc.base.ScopeDirectory())
-	showCategories := getShowCategories(sc.base.ScopeDirectory())
 
-	// Top
+	// Continue Watching
 	// ================================
-	topType := rand.Intn(2)
-	if topType == 0 {
-		// show top videos
-		videoCategory := videoCatgories[rand.Intn(len(videoCatgories))].Label
-		videos := getVideosByCategory(videoCategory, "", "today", "view-count", 1, 10)
-		category := reply.RegisterCategory("home", fmt.Sprintf("今日%s视频TOP10", videoCategory), "", homeCategoryTemplate)
-		// show videos
-		pushData(videos, category, reply)
-	} else {
-		// show top shows
-		showCategory := showCategories[rand.Intn(len(showCategories))].Label
-		for showCategory == "音乐" {
-			showCategory = showCategories[rand.Intn(len(showCategories))].Label
+	history := getHistory(sc.base.CacheDirectory())
+	if len(history) > 0 {
+		if len(history) > 10 {
+			history = history[:10]
 		}
-		shows := getShowsByCategory(showCategory, "", "view-today-count", 1, 10)
-		category := reply.RegisterCategory("home", fmt.Sprintf("今日%s节目TOP10", showCategory), "", homeCategoryTemplate)
-		// Show shows
-		pushData(shows, category, reply)
+		category := reply.RegisterCategory("continue", sc.locale.tr("继续观看"), "", homeCategoryTemplate.JSON())
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(historyItems(history))
 	}
 
-	// Section One
+	// Followed Shows Updates
 	// ================================
-	if topType == 0 {
-		showCategory := showCategories[rand.Intn(len(showCategories))].Label
-		for showCategory == "音乐" {
-			showCategory = showCategories[rand.Intn(len(showCategories))].Label
+	checkFollowUpdates(sc.base.CacheDirectory())
+	updatedShows := []FollowedShow{}
+	for _, show := range getFollowedShows(sc.base.CacheDirectory()) {
+		if show.HasUpdate() {
+			updatedShows = append(updatedShows, show)
 		}
-		shows := getShowsByCategory(showCategory, "", "view-today-count", 1, 9)
-		category := reply.RegisterCategory("section_one", fmt.Sprintf("%s节目", showCategory), "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
-		// Show shows
-		pushData(shows, category, reply)
-	} else {
-		videoCategory := videoCatgories[rand.Intn(len(videoCatgories))].Label
-		videos := getVideosByCategory(videoCategory, "", "today", "view-count", 1, 9)
-		category := reply.RegisterCategory("section_one", fmt.Sprintf("%s视频", videoCategory), "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
-		// Show videos
-		pushData(videos, category, reply)
+	}
+	if len(updatedShows) > 0 {
+		category := reply.RegisterCategory("follow_updates", sc.locale.tr("追剧更新"), "", videoCategoryTemplate(itemSize).JSON())
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(followedShowItems(updatedShows))
 	}
 
-	// Section Two
+	// Sections
 	// ================================
-	showCategory := showCategories[rand.Intn(len(showCategories))].Label
-	for showCategory == "音乐" {
-		showCategory = showCategories[rand.Intn(len(showCategories))].Label
+	sections := getHomeLayout(sc.base.ScopeDirectory(), sc.ScopeSettings.HomeLayout)
+	if sc.ScopeSettings.HomeRandom {
+		sections = append(sections, HomeSection{Type: "random"}.withDefaults())
 	}
-	shows := getShowsByCategory(showCategory, "", "view-today-count", 1, 10)
-	category := reply.RegisterCategory("section_two_large", fmt.Sprintf("%s节目", showCategory), "", largeVideoCategoryTemplate)
-
-	if len(shows) > 1 {
-		showFirst := shows[0]
-		result := scopes.NewCategorisedResult(category)
-		result.SetTitle(showFirst.Name)
-		result.SetArt(showFirst.Thumbnail)
-		result.SetURI(showFirst.Link)
-		result.Set("subtitle", fmt.Sprintf("更新 %s", fmt.Sprint(showFirst.EpisodeUpdated)))
-		result.Set("attributes", []map[string]string{
-			{"value": fmt.Sprintf("★%.2f", formatScore(showFirst.Score))},
-			{"value": fmt.Sprintf("🔥%s", formatCount(showFirst.ViewCount))},
-		})
-		result.Set("show_id", showFirst.ID)
-		result.Set("type", "show")
-		if err := reply.Push(result); err != nil {
-			logger.Println("[ERROR]", err)
+	location := sc.userLocation(metadata)
+	profile := getAffinityProfile(sc.base.CacheDirectory(), sc.categories)
+	watched := watchedIDs(sc.base.CacheDirectory())
+	shown := map[Affinity]bool{}
+	for _, section := range sections {
+		shown[Affinity{Type: section.Type, Category: section.Category, Genre: section.Genre}] = true
+	}
+	for i, section := range sections {
+		switch section.Type {
+		case "recommend", "random":
+			var picked HomeSection
+			if section.Type == "recommend" {
+				picked = recommendHomeSection(profile, shown, sc.categories)
+			} else {
+				picked = randomHomeSection(sc.categories)
+			}
+			if section.Count > 0 {
+				picked.Count = section.Count
+			}
+			if section.Template != "" {
+				picked.Template = section.Template
+			}
+			section = picked.withDefaults()
+		case "local":
+			sc.showLocalSection(fmt.Sprintf("section_%d", i), section, location, watched, reply)
+			continue
 		}
+		sc.showHomeSection(fmt.Sprintf("section_%d", i), section, watched, reply)
+	}
+}
+
+// Most items fetched for a home section
+const homeSectionMaxFetch = 100
+
+func (sc *YoukuScope) showHomeSection(id string, section HomeSection, watched map[string]bool, reply *scopes.SearchReply) {
+
+	logger.Println("[HOME SECTION]", id, section)
 
-		shows = shows[1:]
+	var items []Renderable
+	var title string
+
+	name := sc.categories.Label(sc.locale, section.Type, section.Category)
+	if section.Genre != "" {
+		name = fmt.Sprintf(sc.locale.tr("%[2]s%[1]s"), name, sc.categories.GenreLabel(sc.locale, section.Type, section.Category, section.Genre))
 	}
-	category = reply.RegisterCategory("section_two", "", "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
-	// Show shows
-	pushData(shows, category, reply)
+	name = section.Area + name
 
-	// Section Three
-	// ================================
-	videoCategory := videoCatgories[rand.Intn(len(videoCatgories))].Label
-	videos := getVideosByCategory(videoCategory, "", "today", "view-count", 1, 10)
-	category = reply.RegisterCategory("section_three_large", fmt.Sprintf("%s视频", videoCategory), "", largeVideoCategoryTemplate)
-
-	if len(videos) > 1 {
-		videoFirst := videos[0]
-		result := scopes.NewCategorisedResult(category)
-		result.SetTitle(videoFirst.Title)
-		result.SetArt(videoFirst.Thumbnail)
-		result.SetURI(videoFirst.Link)
-		result.Set("attributes", []map[string]string{
-			{"value": fmt.Sprintf("🕒%s", formatDuration(videoFirst.Duration))},
-			{"value": fmt.Sprintf("🔥%s", formatCount(videoFirst.ViewCount))},
-		})
-		result.Set("video_id", videoFirst.ID)
-		result.Set("type", "video")
-		if err := reply.Push(result); err != nil {
-			logger.Println("[ERROR]", err)
+	// fetch more for the watched ones left out
+	count := section.Count + len(watched)
+	if count > homeSectionMaxFetch {
+		count = homeSectionMaxFetch
+	}
+
+	switch section.Type {
+	case "video":
+		videos := getVideosByCategory(section.Category, section.Genre, section.Period, section.OrderBy, 1, count)
+		sc.stats.Record(videoRankingStats(rankingName("video", section.Category, section.Genre, section.OrderBy), videos))
+		for _, video := range videos {
+			if !watched["video_"+video.ID] {
+				items = append(items, video)
+			}
+		}
+		title = fmt.Sprintf(sc.locale.tr("%s视频"), name)
+	case "show":
+		shows := getShowsByCategory(section.Category, section.Genre, section.Area, section.OrderBy, 1, count)
+		if section.Area == "" {
+			sc.stats.Record(showRankingStats(rankingName("show", section.Category, section.Genre, section.OrderBy), shows))
+		}
+		for _, show := range shows {
+			if !watched["show_"+show.ID] {
+				items = append(items, show)
+			}
 		}
+		title = fmt.Sprintf(sc.locale.tr("%s节目"), name)
+	default:
+		return
+	}
+	if len(items) > section.Count {
+		items = items[:section.Count]
+	}
+	switch {
+	case section.Recommended:
+		title = sc.locale.tr("猜你喜欢 · ") + title
+	case section.Random:
+		title = sc.locale.tr("随机推荐 · ") + title
+	}
 
-		videos = videos[1:]
+	switch section.Template {
+	case "carousel":
+		category := reply.RegisterCategory(id, fmt.Sprintf(sc.locale.tr("今日%sTOP%d"), title, len(items)), "", homeCategoryTemplate.JSON())
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
+	case "large":
+		// the first one is large, the others in grid
+		if len(items) > 1 {
+			category := reply.RegisterCategory(id+"_large", title, "", largeVideoCategoryTemplate.JSON())
+			ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items[:1])
+			items = items[1:]
+			title = ""
+		}
+		category := reply.RegisterCategory(id, title, "", categoryTemplate(section.Type, section.Category))
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
+	default:
+		category := reply.RegisterCategory(id, title, "", categoryTemplate(section.Type, section.Category))
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
 	}
-	category = reply.RegisterCategory("section_three", "", "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
-	// Show videos
-	pushData(videos, category, reply)
 }
 
-func (sc *YoukuScope) createDepartment(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) *scopes.Department {
-	home, _ := scopes.NewDepartment("", query, "首页")
-
-	videoDepartment, _ := scopes.NewDepartment("video", query, "视频")
-	videoCatgories := getVideoCategories(sc.base.ScopeDirectory())
-	for _, v := range videoCatgories {
-		subID := "video_" + v.Label
-		subDepartment, _ := scopes.NewDepartment(subID, query, v.Label)
-		for _, genre := range v.Genres {
-			genreID := subID + "_" + genre.Label
-			genreDepartment, _ := scopes.NewDepartment(genreID, query, genre.Label)
-			subDepartment.AddSubdepartment(genreDepartment)
+// showLocalSection shows the popular news of the city of user, and the
+// shows of the area of user
+func (sc *YoukuScope) showLocalSection(id string, section HomeSection, location *scopes.Location, watched map[string]bool, reply *scopes.SearchReply) {
+
+	city, area := localName(location), localArea(location)
+	logger.Println("[HOME LOCAL]", city, area)
+
+	// the news of city, only the shows of area if the city is unknown
+	if city != "" {
+		items := []Renderable{}
+		for _, video := range queryVideosByKeyword(city, "资讯", "week", "view-count", section.Count) {
+			if !watched["video_"+video.ID] {
+				items = append(items, video)
+			}
+		}
+		if len(items) > 0 {
+			template := categoryTemplate("video", "资讯")
+			if section.Template == "carousel" {
+				template = homeCategoryTemplate.JSON()
+			}
+			category := reply.RegisterCategory(id, fmt.Sprintf(sc.locale.tr("本地热门 · %s"), city), "", template)
+			ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
 		}
-		videoDepartment.AddSubdepartment(subDepartment)
 	}
 
-	showDepartment, _ := scopes.NewDepartment("show", query, "节目")
-	showCategories := getShowCategories(sc.base.ScopeDirectory())
-	for _, v := range showCategories {
-		subID := "show_" + v.Label
-		subDepartment, _ := scopes.NewDepartment(subID, query, v.Label)
-		for _, genre := range v.Genre {
-			genreID := subID + "_" + genre.Label
-			genreDepartment, _ := scopes.NewDepartment(genreID, query, genre.Label)
-			subDepartment.AddSubdepartment(genreDepartment)
+	if area != "" {
+		shows := HomeSection{Type: "show", Category: "电视剧", Area: area, Count: section.Count}
+		sc.showHomeSection(id+"_area", shows.withDefaults(), watched, reply)
+	}
+}
+
+func (sc *YoukuScope) showHistory(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
+
+	history := getHistory(sc.base.CacheDirectory())
+	category := reply.RegisterCategory("history", sc.locale.tr("历史记录"), "", videoCategoryTemplate(itemSize).JSON())
+	if len(history) == 0 {
+		return
+	}
+
+	// Clear history
+	result := scopes.NewCategorisedResult(category)
+	result.SetTitle(sc.locale.tr("清空历史记录"))
+	result.SetArt(sc.base.ScopeDirectory() + "/icon.png")
+	result.SetURI("history:clear")
+	result.Set("subtitle", fmt.Sprintf(sc.locale.tr("共 %d 条"), len(history)))
+	result.Set("type", "clear_history")
+	result.SetInterceptActivation()
+	if err := reply.Push(result); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(historyItems(history))
+}
+
+func (sc *YoukuScope) showFollow(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
+
+	checkFollowUpdates(sc.base.CacheDirectory())
+
+	// Shows with new episodes first
+	updated := []FollowedShow{}
+	others := []FollowedShow{}
+	for _, show := range getFollowedShows(sc.base.CacheDirectory()) {
+		if show.HasUpdate() {
+			updated = append(updated, show)
+		} else {
+			others = append(others, show)
 		}
-		showDepartment.AddSubdepartment(subDepartment)
 	}
 
+	category := reply.RegisterCategory("follow", sc.locale.tr("追剧"), "", videoCategoryTemplate(itemSize).JSON())
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(followedShowItems(append(updated, others...)))
+}
+
+func (sc *YoukuScope) showDownloads(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
+
+	items := []Renderable{}
+	for _, item := range sc.downloads.Items() {
+		items = append(items, item)
+	}
+
+	category := reply.RegisterCategory("downloads", sc.locale.tr("已下载"), "", videoCategoryTemplate(itemSize).JSON())
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(items)
+}
+
+func (sc *YoukuScope) createDepartment(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) *scopes.Department {
+	home, _ := scopes.NewDepartment("", query, sc.locale.tr("首页"))
+
+	videoDepartment, _ := scopes.NewDepartment("video", query, sc.locale.tr("视频"))
+	sc.addCategoryDepartments(videoDepartment, "video", query)
+
+	showDepartment, _ := scopes.NewDepartment("show", query, sc.locale.tr("节目"))
+	sc.addCategoryDepartments(showDepartment, "show", query)
+
+	followDepartment, _ := scopes.NewDepartment("follow", query, sc.locale.tr("追剧"))
+	historyDepartment, _ := scopes.NewDepartment("history", query, sc.locale.tr("历史记录"))
+	downloadsDepartment, _ := scopes.NewDepartment("downloads", query, sc.locale.tr("已下载"))
+
 	home.AddSubdepartment(videoDepartment)
 	home.AddSubdepartment(showDepartment)
+	home.AddSubdepartment(followDepartment)
+	home.AddSubdepartment(historyDepartment)
+	home.AddSubdepartment(downloadsDepartment)
 
 	return home
 }
 
-func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewReply) {
+// addCategoryDepartments adds the categories of kind and their genres to parent
+func (sc *YoukuScope) addCategoryDepartments(parent *scopes.Department, kind string, query *scopes.CannedQuery) {
+	for _, c := range sc.categories.Categories(kind) {
+		id := DepartmentID{Kind: kind, Term: c.Term}
+		label := c.Label
+		if !sc.locale.isChinese() {
+			label = termLabel(c.Term)
+		}
+		subDepartment, _ := scopes.NewDepartment(id.String(), query, label)
+		for _, genre := range c.Genres {
+			id.Genre = genre.Term
+			label = genre.Label
+			if !sc.locale.isChinese() {
+				label = termLabel(genre.Term)
+			}
+			genreDepartment, _ := scopes.NewDepartment(id.String(), query, label)
+			subDepartment.AddSubdepartment(genreDepartment)
+		}
+		parent.AddSubdepartment(subDepartment)
+	}
+}
+
+func (sc *YoukuScope) viewVideo(videoID string, fromHistory bool, reply *scopes.PreviewReply) {
 	layoutOneCol := scopes.NewColumnLayout(1)
 	layoutOneCol.AddColumn(
 		"header",
 		"video",
 		"info",
+		"trend",
 		"expandable",
 		"description",
 		"actions",
@@ -491,30 +758,38 @@ func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewRepl
 	)
 	layoutTwoCol.AddColumn(
 		"info",
+		"trend",
 		"description",
 		"comments",
 	)
 	reply.RegisterLayout(layoutOneCol, layoutTwoCol)
 
-	var videoID string
-	err := result.Get("video_id", &videoID)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return
-	}
 	video := getVideoDetail(videoID)
 	logger.Println("[VIDEO PREVIEW]", videoID, video.Title, video.Duration)
 
+	// Record history
+	addHistory(sc.base.CacheDirectory(), HistoryItem{
+		Type:      "video",
+		ID:        video.ID,
+		Title:     video.Title,
+		Thumbnail: video.Thumbnail,
+		Link:      video.Link,
+		Category:  video.Category,
+		Episode:   video.Show.Stage,
+	})
+
 	// Header
 	header := scopes.NewPreviewWidget("header", "header")
 	header.AddAttributeValue("title", video.Title)
 	duration := formatDuration(video.Duration)
-	header.AddAttributeValue("subtitle", "时长: "+duration)
+	header.AddAttributeValue("subtitle", fmt.Sprintf(sc.locale.tr("时长: %s"), duration))
+	header.AddAttributeValue("attributes", qualityAttributes(sc.locale, video.StreamTypes))
 
 	// Video
+	playURI, playType := sc.playStream(video)
 	videoWidget := scopes.NewPreviewWidget("video", "video")
-	videoWidget.AddAttributeValue("source", video.Link)
-	videoWidget.AddAttributeValue("screenshot", video.Video.BigThumbnail)
+	videoWidget.AddAttributeValue("source", playURI)
+	videoWidget.AddAttributeValue("screenshot", video.BigThumbnail)
 	shareData := map[string]string{
 		"uri":          video.Link,
 		"content-type": "links",
@@ -523,20 +798,47 @@ func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewRepl
 
 	// Info
 	info := scopes.NewPreviewWidget("info", "table")
-	info.AddAttributeValue("title", "信息")
+	info.AddAttributeValue("title", sc.locale.tr("信息"))
 	table := [][]string{
-		{"类型", video.Category},
-		{"标签", video.Tags},
-		{"发布时间", video.Published},
-		{"总播放数", formatCount(video.ViewCount)},
-		{"评论/收藏", fmt.Sprintf("%s / %s", video.CommentCount, video.FavoriteCount)},
-		{"顶/踩", fmt.Sprintf("%s / %s", video.UpCount, video.DownCount)},
+		{sc.locale.tr("类型"), sc.categories.Label(sc.locale, "video", video.Category)},
+		{sc.locale.tr("标签"), video.Tags},
+		{sc.locale.tr("发布时间"), video.Published},
+		{sc.locale.tr("总播放数"), sc.locale.formatCount(video.ViewCount)},
+		{sc.locale.tr("评论/收藏"), fmt.Sprintf("%s / %s", sc.locale.formatCount(video.CommentCount), sc.locale.formatCount(video.FavoriteCount))},
+		{sc.locale.tr("顶/踩"), fmt.Sprintf("%s / %s", sc.locale.formatCount(video.UpCount), sc.locale.formatCount(video.DownCount))},
+		{sc.locale.tr("引用数"), sc.locale.formatCount(video.ReferenceCount)},
+	}
+	if video.User.Name != "" {
+		table = append(table, []string{sc.locale.tr("上传者"), video.User.Name})
+	}
+	if video.Source.Name != "" {
+		table = append(table, []string{sc.locale.tr("来源"), video.Source.Name})
+	}
+	if video.Show.ID != "" {
+		showName := video.Show.Name
+		if video.Show.Stage > 0 {
+			showName += fmt.Sprintf(sc.locale.tr(" 第%d集"), video.Show.Stage)
+		}
+		table = append(table, []string{sc.locale.tr("所属节目"), showName})
+	}
+	if labels := qualities(sc.locale, video.StreamTypes); len(labels) > 0 {
+		table = append(table, []string{sc.locale.tr("清晰度"), strings.Join(labels, " / ")})
+	}
+	if len(video.OperationLimit) > 0 {
+		limits := []string{}
+		for _, limit := range video.OperationLimit {
+			if label, ok := operationLimitLabels[limit]; ok {
+				limit = sc.locale.tr(label)
+			}
+			limits = append(limits, limit)
+		}
+		table = append(table, []string{sc.locale.tr("限制"), strings.Join(limits, " / ")})
 	}
 	info.AddAttributeValue("values", table)
 
 	// Expandable Content
 	expandableWidget := scopes.NewPreviewWidget("expandable", "expandable")
-	expandableWidget.AddAttributeValue("title", "截图")
+	expandableWidget.AddAttributeValue("title", sc.locale.tr("截图"))
 	// Screenshots
 	screenshots := scopes.NewPreviewWidget("screenshots", "gallery")
 	links := []string{}
@@ -552,23 +854,41 @@ func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewRepl
 
 	// Description
 	description := scopes.NewPreviewWidget("description", "text")
-	description.AddAttributeValue("title", "描述")
+	description.AddAttributeValue("title", sc.locale.tr("描述"))
 	var desText string
 	if desText = video.Description; desText == "" {
-		desText = "无"
+		desText = sc.locale.tr("无")
 	}
 	description.AddAttributeValue("text", desText)
 
 	// Actions
 	actions := scopes.NewPreviewWidget("actions", "actions")
 	acts := []map[string]string{
-		{"id": "play", "label": "播放"},
+		{"id": "play", "label": playLabel(sc.locale, sc.locale.tr("播放"), playType), "uri": playURI},
+	}
+	if video.Show.ID != "" {
+		acts = append(acts, map[string]string{"id": "view_show:" + video.Show.ID, "label": sc.locale.tr("查看节目")})
+		prev, next := getAdjacentEpisodes(video.Show.ID, video.Show.Sequence)
+		if prev.ID != "" {
+			acts = append(acts, map[string]string{"id": "view_video:" + prev.ID, "label": sc.locale.tr("上一集")})
+		}
+		if next.ID != "" {
+			acts = append(acts, map[string]string{"id": "view_video:" + next.ID, "label": sc.locale.tr("下一集")})
+		}
+	}
+	if item, ok := sc.downloads.Item(video.ID); ok {
+		acts = append(acts, map[string]string{"id": "view_download:" + video.ID, "label": item.StatusLabel(sc.locale)})
+	} else if video.Downloadable() {
+		acts = append(acts, map[string]string{"id": "download:" + video.ID, "label": sc.locale.tr("下载")})
+	}
+	if fromHistory {
+		acts = append(acts, map[string]string{"id": "remove_history", "label": sc.locale.tr("删除记录")})
 	}
 	actions.AddAttributeValue("actions", acts)
 
 	// Expandable Comments
 	expandableComments := scopes.NewPreviewWidget("comments", "expandable")
-	expandableComments.AddAttributeValue("title", "评论")
+	expandableComments.AddAttributeValue("title", sc.locale.tr("评论"))
 	expandableComments.AddAttributeValue("collapsed-widgets", 2)
 
 	logger.Println(sc, sc.ScopeSettings)
@@ -577,14 +897,7 @@ func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewRepl
 	if sc.ScopeSettings == nil {
 		logger.Println("setting: ", sc.ScopeSettings)
 		// Get Settings
-		var s settings
-		err := sc.base.Settings(&s)
-		if err != nil {
-			logger.Println("[ERROR]", err)
-			sc.ScopeSettings = &settings{50, 1, 20}
-		} else {
-			sc.ScopeSettings = &s
-		}
+		sc.loadSettings()
 	}
 
 	// Comments
@@ -607,15 +920,76 @@ func (sc *YoukuScope) viewVideo(result *scopes.Result, reply *scopes.PreviewRepl
 		expandableComments.AddWidget(commentWidget)
 	}
 
-	reply.PushWidgets(header, videoWidget, info, expandableWidget, description, actions, expandableComments)
+	widgets := []scopes.PreviewWidget{header, videoWidget, info}
+	if trend, ok := sc.trendWidget("video_"+video.ID, video.ViewCount, 0); ok {
+		widgets = append(widgets, trend)
+	}
+	widgets = append(widgets, expandableWidget, description, actions, expandableComments)
+	reply.PushWidgets(widgets...)
+}
+
+// trendWidget records the current views of a video or show, and returns
+// the table of its snapshots in the last 7 days
+// Labels of the orders of rankings
+var orderByLabels = map[string]string{
+	"published":        "发布时间",
+	"view-count":       "总播放数",
+	"comment-count":    "总评论数",
+	"reference-count":  "总引用数",
+	"favorite-count":   "总收藏数",
+	"view-today-count": "今日播放数",
+	"view-week-count":  "本周播放数",
+	"release-date":     "上映日期",
+	"score":            "评分",
+	"updated":          "最后更新",
 }
 
-func (sc *YoukuScope) viewShow(result *scopes.Result, reply *scopes.PreviewReply) {
+// rankingLabel returns the label of ranking like "show/电影/view-count"
+func (sc *YoukuScope) rankingLabel(ranking string) string {
+	parts := strings.Split(ranking, "/")
+	if len(parts) < 3 {
+		return ranking
+	}
+	kind, category, orderby := parts[0], parts[1], parts[len(parts)-1]
+	name := sc.categories.Label(sc.locale, kind, category)
+	if len(parts) == 4 {
+		name = fmt.Sprintf(sc.locale.tr("%[2]s%[1]s"), name, sc.categories.GenreLabel(sc.locale, kind, category, parts[2]))
+	}
+	if label, ok := orderByLabels[orderby]; ok {
+		orderby = sc.locale.tr(label)
+	}
+	return name + " · " + orderby
+}
+
+func (sc *YoukuScope) trendWidget(key string, views FlexInt, score FlexFloat) (scopes.PreviewWidget, bool) {
+	sc.stats.Record(map[string]StatPoint{
+		key: {ViewCount: views, Score: score},
+	})
+
+	rows, ranking := statsTable(sc.locale, sc.stats.Get(key), 7, time.Now())
+	if len(rows) == 0 {
+		return nil, false
+	}
+
+	rankLabel := sc.locale.tr("排名")
+	if ranking != "" {
+		rankLabel = fmt.Sprintf(sc.locale.tr("%s排名"), sc.rankingLabel(ranking))
+	}
+
+	trend := scopes.NewPreviewWidget("trend", "table")
+	trend.AddAttributeValue("title", sc.locale.tr("近7日趋势"))
+	table := [][]string{{sc.locale.tr("日期"), rankLabel, sc.locale.tr("播放"), sc.locale.tr("增长")}}
+	trend.AddAttributeValue("values", append(table, rows...))
+	return trend, true
+}
+
+func (sc *YoukuScope) viewShow(showID string, fromHistory bool, reply *scopes.PreviewReply) {
 	layoutOneCol := scopes.NewColumnLayout(1)
 	layoutOneCol.AddColumn(
 		"header",
 		"show",
 		"info",
+		"trend",
 		"expandable",
 		"description",
 		"actions",
@@ -628,28 +1002,49 @@ func (sc *YoukuScope) viewShow(result *scopes.Result, reply *scopes.PreviewReply
 	)
 	layoutTwoCol.AddColumn(
 		"info",
+		"trend",
 		"expandable",
 		"description",
 	)
 	reply.RegisterLayout(layoutOneCol, layoutTwoCol)
 
-	var showID string
-	err := result.Get("show_id", &showID)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return
-	}
 	show := getShowDetail(showID)
 	logger.Println("[SHOW PREVIEW]", showID, show.Name)
 
+	// Record history
+	addHistory(sc.base.CacheDirectory(), HistoryItem{
+		Type:      "show",
+		ID:        show.ID,
+		Title:     show.Name,
+		Thumbnail: show.Thumbnail,
+		Link:      show.Link,
+		Category:  show.Category,
+		Genre:     firstGenre(show.Genre),
+		Episode:   show.EpisodeUpdated,
+	})
+
+	// Mark the followed show seen
+	followed := isFollowed(sc.base.CacheDirectory(), show.ID)
+	if followed {
+		markFollowedShowSeen(sc.base.CacheDirectory(), show)
+	}
+
 	// Header
 	header := scopes.NewPreviewWidget("header", "header")
 	header.AddAttributeValue("title", show.Name)
-	header.AddAttributeValue("subtitle", fmt.Sprintf("评分: %.1f", formatScore(show.Score)))
+	header.AddAttributeValue("subtitle", fmt.Sprintf(sc.locale.tr("评分: %.1f"), show.Score))
+
+	// Play the first episode in the preferred quality
+	episode := VideoDetail{StreamTypes: show.StreamTypes}
+	episode.ID, episode.Link = videoIDOfLink(show.PlayLink), show.PlayLink
+	playURI, playType := show.PlayLink, ""
+	if episode.ID != "" {
+		playURI, playType = sc.playStream(episode)
+	}
 
 	// Show
 	showWidget := scopes.NewPreviewWidget("show", "video")
-	showWidget.AddAttributeValue("source", show.PlayLink)
+	showWidget.AddAttributeValue("source", playURI)
 	if show.ThumbnailLarge != "" {
 		showWidget.AddAttributeValue("screenshot", show.ThumbnailLarge)
 	} else {
@@ -663,304 +1058,390 @@ func (sc *YoukuScope) viewShow(result *scopes.Result, reply *scopes.PreviewReply
 
 	// Info
 	info := scopes.NewPreviewWidget("info", "table")
-	info.AddAttributeValue("title", "信息")
+	info.AddAttributeValue("title", sc.locale.tr("信息"))
 	table := [][]string{
-		{"类型", show.Genre},
-		{"地区", show.Area},
-		{"上映", show.Released},
-		{"更新至/总集数", fmt.Sprintf("%s / %s", fmt.Sprint(show.EpisodeUpdated), fmt.Sprint(show.EpisodeCount))},
-		{"周播放/总播放", fmt.Sprintf("%s / %s", formatCount(show.ViewWeekCount), formatCount(show.ViewCount))},
-		{"评论/收藏", fmt.Sprintf("%s / %s", formatCount(show.CommentCount), formatCount(show.FavoriteCount))},
-		{"顶/踩", fmt.Sprintf("%s / %s", formatCount(show.UpCount), formatCount(show.DownCount))},
+		{sc.locale.tr("类型"), show.Genre},
+		{sc.locale.tr("地区"), show.Area},
+		{sc.locale.tr("上映"), show.Released},
+		{sc.locale.tr("更新至/总集数"), fmt.Sprintf("%d / %d", show.EpisodeUpdated, show.EpisodeCount)},
+		{sc.locale.tr("周播放/总播放"), fmt.Sprintf("%s / %s", sc.locale.formatCount(show.ViewWeekCount), sc.locale.formatCount(show.ViewCount))},
+		{sc.locale.tr("评论/收藏"), fmt.Sprintf("%s / %s", sc.locale.formatCount(show.CommentCount), sc.locale.formatCount(show.FavoriteCount))},
+		{sc.locale.tr("顶/踩"), fmt.Sprintf("%s / %s", sc.locale.formatCount(show.UpCount), sc.locale.formatCount(show.DownCount))},
+		{sc.locale.tr("清晰度"), strings.Join(qualities(sc.locale, show.StreamTypes), " / ")},
 	}
 	info.AddAttributeValue("values", table)
 
+	// Expandable Poster
+	expandableWidget := scopes.NewPreviewWidget("expandable", "expandable")
+	expandableWidget.AddAttributeValue("title", sc.locale.tr("海报"))
+	poster := scopes.NewPreviewWidget("poster", "image")
+	if show.PosterLarge != "" {
+		poster.AddAttributeValue("source", show.PosterLarge)
+	} else {
+		poster.AddAttributeValue("source", show.Poster)
+	}
+	poster.AddAttributeValue("zoomable", true)
+	expandableWidget.AddWidget(poster)
+
 	// Description
 	description := scopes.NewPreviewWidget("description", "text")
-	description.AddAttributeValue("title", "描述")
+	description.AddAttributeValue("title", sc.locale.tr("描述"))
 	description.AddAttributeValue("text", show.Description)
 
 	// Actions
 	actions := scopes.NewPreviewWidget("actions", "actions")
 	acts := []map[string]string{
-		{"id": "play", "label": "分集播放"},
+		{"id": "play", "label": playLabel(sc.locale, sc.locale.tr("分集播放"), playType), "uri": playURI},
+	}
+	if followed {
+		acts = append(acts, map[string]string{"id": "unfollow:" + show.ID, "label": sc.locale.tr("取消追剧")})
+	} else {
+		acts = append(acts, map[string]string{"id": "follow:" + show.ID, "label": sc.locale.tr("加入追剧")})
+	}
+	if fromHistory {
+		acts = append(acts, map[string]string{"id": "remove_history", "label": sc.locale.tr("删除记录")})
 	}
 	actions.AddAttributeValue("actions", acts)
 
-	reply.PushWidgets(header, showWidget, info, description, actions)
+	widgets := []scopes.PreviewWidget{header, showWidget, info}
+	if trend, ok := sc.trendWidget("show_"+show.ID, show.ViewCount, show.Score); ok {
+		widgets = append(widgets, trend)
+	}
+	if show.PosterLarge != "" || show.Poster != "" {
+		widgets = append(widgets, expandableWidget)
+	}
+	widgets = append(widgets, description, actions)
+	reply.PushWidgets(widgets...)
 }
 
-func (sc *YoukuScope) queryVideo(keyword, departmentID string, reply *scopes.SearchReply) {
+// viewDownload shows the downloaded video, which can be played without
+// network
+func (sc *YoukuScope) viewDownload(videoID string, reply *scopes.PreviewReply) {
+	layoutOneCol := scopes.NewColumnLayout(1)
+	layoutOneCol.AddColumn(
+		"header",
+		"video",
+		"info",
+		"actions",
+	)
+	layoutTwoCol := scopes.NewColumnLayout(2)
+	layoutTwoCol.AddColumn(
+		"header",
+		"video",
+		"actions",
+	)
+	layoutTwoCol.AddColumn(
+		"info",
+	)
+	reply.RegisterLayout(layoutOneCol, layoutTwoCol)
 
-	logger.Printf("[QUERY VIDEOS] keyword: %s departmentID: %s\n", keyword, departmentID)
+	item, ok := sc.downloads.Item(videoID)
+	if !ok {
+		return
+	}
+	logger.Println("[DOWNLOAD PREVIEW]", videoID, item.Title, item.Status)
 
-	var videoCategory string
-	_deptIDs := strings.Split(departmentID, "_")
-	if len(_deptIDs) > 1 {
-		videoCategory = _deptIDs[1]
+	uri := item.Link
+	if item.Status == downloadDone {
+		uri = "file://" + sc.downloads.FilePath(item)
 	}
 
-	videos := queryVideosByKeyword(keyword, videoCategory, "history", "relevance", int(sc.ScopeSettings.ResultCount))
+	// Header
+	header := scopes.NewPreviewWidget("header", "header")
+	header.AddAttributeValue("title", item.Title)
+	header.AddAttributeValue("subtitle", item.StatusLabel(sc.locale))
 
-	category := reply.RegisterCategory("query_video", fmt.Sprintf("%s 相关%s视频", keyword, videoCategory), "", queryVideoTemplate)
-	// Show Videos
-	pushData(videos, category, reply)
-}
+	// Video
+	videoWidget := scopes.NewPreviewWidget("video", "video")
+	videoWidget.AddAttributeValue("source", uri)
+	videoWidget.AddAttributeValue("screenshot", item.Thumbnail)
 
-func (sc *YoukuScope) queryShow(keyword, departmentID string, reply *scopes.SearchReply) {
-	logger.Printf("[QUERY SHOWS] keyword: %s departmentID: %s\n", keyword, departmentID)
+	// Info
+	info := scopes.NewPreviewWidget("info", "table")
+	info.AddAttributeValue("title", sc.locale.tr("信息"))
+	table := [][]string{
+		{sc.locale.tr("时长"), formatDuration(item.Duration)},
+		{sc.locale.tr("清晰度"), sc.locale.tr(qualityLabels[streamTypeQuality(item.StreamType)])},
+		{sc.locale.tr("大小"), formatSize(item.Downloaded)},
+		{sc.locale.tr("状态"), item.StatusLabel(sc.locale)},
+	}
+	if item.Error != "" {
+		table = append(table, []string{sc.locale.tr("错误"), sc.locale.tr(item.Error)})
+	}
+	info.AddAttributeValue("values", table)
 
-	var showCategory string
-	_deptIDs := strings.Split(departmentID, "_")
-	if len(_deptIDs) > 1 {
-		showCategory = _deptIDs[1]
+	// Actions
+	actions := scopes.NewPreviewWidget("actions", "actions")
+	acts := []map[string]string{}
+	if item.Status == downloadDone {
+		acts = append(acts, map[string]string{"id": "play", "label": sc.locale.tr("播放"), "uri": uri})
+	}
+	if item.Status == downloadFailed {
+		acts = append(acts, map[string]string{"id": "download:" + item.ID, "label": sc.locale.tr("重新下载")})
 	}
+	acts = append(acts,
+		map[string]string{"id": "view_video:" + item.ID, "label": sc.locale.tr("查看视频")},
+		map[string]string{"id": "remove_download:" + item.ID, "label": sc.locale.tr("删除下载")},
+	)
+	actions.AddAttributeValue("actions", acts)
 
-	shows := queryShowsByKeyword(keyword, showCategory, 0, "view-couint", int(sc.ScopeSettings.ResultCount))
+	reply.PushWidgets(header, videoWidget, info, actions)
+}
 
-	category := reply.RegisterCategory("query_show", fmt.Sprintf("%s 相关%s节目", keyword, showCategory), "", queryVideoTemplate)
+// viewError shows the error of an action with the action to retry it
+func (sc *YoukuScope) viewError(message, retryID string, reply *scopes.PreviewReply) {
+	layout := scopes.NewColumnLayout(1)
+	layout.AddColumn("header", "actions")
+	reply.RegisterLayout(layout)
 
-	// Show shows
-	pushData(shows, category, reply)
+	header := scopes.NewPreviewWidget("header", "header")
+	header.AddAttributeValue("title", message)
+	header.AddAttributeValue("subtitle", sc.locale.tr("请检查网络后重试"))
+
+	actions := scopes.NewPreviewWidget("actions", "actions")
+	actions.AddAttributeValue("actions", []map[string]string{{"id": retryID, "label": sc.locale.tr("重试")}})
+
+	reply.PushWidgets(header, actions)
 }
 
-func (sc *YoukuScope) showForAggregatedScopes(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
-	logger.Println("[AGG]", metadata.AggregatedKeywords())
+// viewExport shows the action to export the videos of source, or the
+// playlists exported
+func (sc *YoukuScope) viewExport(source PlaylistSource, reply *scopes.PreviewReply) {
+	layout := scopes.NewColumnLayout(1)
+	layout.AddColumn("header", "info", "actions")
+	reply.RegisterLayout(layout)
 
-	rand.Seed(time.Now().UnixNano())
+	export, exported := sc.exports.Get(source)
 
-	queryString := query.QueryString()
-	keywords := metadata.AggregatedKeywords()
-	var showType, showCategory string
+	header := scopes.NewPreviewWidget("header", "header")
+	header.AddAttributeValue("title", sc.playlistName(source))
 
-	if queryString != "" {
-		sc.queryVideo(queryString, "", reply)
-		// sc.queryShow(queryString, "", reply)
+	actions := scopes.NewPreviewWidget("actions", "actions")
+	acts := []map[string]string{{"id": "export_playlist", "label": sc.locale.tr("导出播放列表")}}
+
+	if !exported {
+		header.AddAttributeValue("subtitle", "M3U8 / XSPF")
+		actions.AddAttributeValue("actions", acts)
+		reply.PushWidgets(header, actions)
+		return
+	}
+	if export.Running {
+		// the action shows the preview again without another export
+		header.AddAttributeValue("subtitle", sc.locale.tr("正在导出…"))
+		acts[0]["label"] = sc.locale.tr("刷新")
+		actions.AddAttributeValue("actions", acts)
+		reply.PushWidgets(header, actions)
 		return
 	}
+	header.AddAttributeValue("subtitle", fmt.Sprintf(sc.locale.tr("共 %d 个视频"), export.Count))
 
-	switch {
-	case isContainsKey("videos", keywords), isContainsKey("video", keywords):
-		if rand.Intn(2) == 0 {
-			showType = "video"
-			categories := getVideoCategories(sc.base.ScopeDirectory())
-			showCategory = categories[rand.Intn(len(categories))].Label
-		} else {
-			showType = "show"
-			categories := getShowCategories(sc.base.ScopeDirectory())
-			showCategory = categories[rand.Intn(len(categories))].Label
-		}
+	info := scopes.NewPreviewWidget("info", "table")
+	info.AddAttributeValue("title", sc.locale.tr("播放列表"))
+	table := [][]string{}
+	uris := []string{}
+	for _, file := range export.Files {
+		table = append(table, []string{strings.ToUpper(strings.TrimPrefix(filepath.Ext(file), ".")), filepath.Base(file)})
+		uris = append(uris, "file://"+file)
+	}
+	if export.Err != nil {
+		table = append(table, []string{sc.locale.tr("错误"), export.Err.Error()})
+	}
+	info.AddAttributeValue("values", table)
 
-	case isContainsKey("music", keywords):
-		showType = "video"
-		showCategory = "音乐"
+	// the cache directory is private, share the files by the content hub
+	if len(uris) > 0 {
+		info.AddAttributeValue("share-data", map[string]interface{}{
+			"uri":          uris,
+			"content-type": "documents",
+		})
+	}
 
-	case isContainsKey("news", keywords):
-		showType = "video"
-		categories := []string{"资讯", "娱乐", "体育资讯", "游戏资讯"}
-		showCategory = categories[rand.Intn(len(categories))]
+	acts[0]["label"] = sc.locale.tr("重新导出")
+	actions.AddAttributeValue("actions", acts)
 
-	case isContainsKey("gaming", keywords):
-		showType = "video"
-		showCategory = "游戏"
+	reply.PushWidgets(header, info, actions)
+}
 
-	case isContainsKey("kids", keywords):
-		showType = "video"
-		categories := []string{"动漫", "亲子"}
-		showCategory = categories[rand.Intn(len(categories))]
+// exportPlaylist exports the videos of source to playlists in background,
+// the progress and the result are shown in the preview of export
+func (sc *YoukuScope) exportPlaylist(source PlaylistSource) {
+	name := sc.playlistName(source)
+	if !sc.exports.Start(source, name) {
+		return
+	}
 
-	case isContainsKey("educational", keywords):
-		if rand.Intn(2) == 0 {
-			showType = "video"
-		} else {
-			showType = "show"
+	resolver, quality, dir := sc.Resolver, sc.ScopeSettings.Quality, playlistDir(sc.base.CacheDirectory())
+	videos, ok := sc.exports.Listed(source)
+	go func() {
+		if !ok {
+			videos = sc.playlistVideos(source)
 		}
-		showCategory = "教育"
+		logger.Println("[EXPORT]", name, len(videos))
 
-	case isContainsKey("finance", keywords):
-		showType = "video"
-		showCategory = "财经资讯"
+		entries := playlistEntries(videos, resolver, quality)
+		files, err := exportPlaylist(dir, name, entries)
+		if err != nil {
+			logger.Println("[ERROR]", err)
+		}
 
-	case isContainsKey("humor", keywords):
-		showType = "video"
-		showCategory = "搞笑"
+		sc.exports.Set(source, PlaylistExport{Name: name, Count: len(entries), Files: files, Err: err})
+	}()
+}
 
-	case isContainsKey("lifestyle", keywords):
-		showType = "video"
-		showCategory = "生活"
+func (sc *YoukuScope) queryVideo(keyword, departmentID string, reply *scopes.SearchReply) {
 
-	case isContainsKey("movies", keywords):
-		if rand.Intn(2) == 0 {
-			showType = "video"
-		} else {
-			showType = "show"
-		}
-		showCategory = "电影"
-		categories := []string{"电影", "微电影"}
-		if showType == "video" {
-			showCategory = categories[rand.Intn(len(categories))]
-		}
+	logger.Printf("[QUERY VIDEOS] keyword: %s departmentID: %s\n", keyword, departmentID)
 
-	case isContainsKey("science", keywords):
-		showType = "video"
-		showCategory = "科技"
+	videoCategory, _ := sc.categories.APIValues(ParseDepartmentID(departmentID))
 
-	case isContainsKey("shopping", keywords):
-		showType = "video"
-		categories := []string{"时尚", "广告"}
-		showCategory = categories[rand.Intn(len(categories))]
+	videos := queryVideosByKeyword(keyword, videoCategory, "history", "relevance", int(sc.ScopeSettings.ResultCount))
 
-	case isContainsKey("sports", keywords):
-		if rand.Intn(2) == 0 {
-			showType = "video"
-		} else {
-			showType = "show"
-		}
-		showCategory = "体育"
+	category := reply.RegisterCategory("query_video", fmt.Sprintf(sc.locale.tr("%s 相关%s视频"), keyword, sc.categories.Label(sc.locale, "video", videoCategory)), "", queryVideoTemplate.JSON())
+	// Show Videos
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(videoDetailItems(videos))
 
-	case isContainsKey("travel", keywords):
-		showType = "video"
-		showCategory = "旅游"
+	if len(videos) > 0 {
+		sc.pushExport(PlaylistSource{Keyword: keyword, DepartmentID: departmentID}, videos, reply)
+	}
+}
 
-	case isContainsKey("tv", keywords):
-		if rand.Intn(2) == 0 {
-			showType = "video"
-		} else {
-			showType = "show"
-		}
-		categories := []string{"电视剧", "网剧", "综艺", "纪录片"}
-		showCategory = categories[rand.Intn(len(categories))]
+func (sc *YoukuScope) queryShow(keyword, departmentID string, reply *scopes.SearchReply) {
+	logger.Printf("[QUERY SHOWS] keyword: %s departmentID: %s\n", keyword, departmentID)
 
-	case isContainsKey("comics", keywords):
-		showType = "video"
-		showCategory = "动漫"
-	}
+	showCategory, _ := sc.categories.APIValues(ParseDepartmentID(departmentID))
 
-	category := reply.RegisterCategory("aggregate", fmt.Sprintf("%s", showCategory), "", fmt.Sprintf(custormVideoCategoryTemplate, itemSize))
+	shows := queryShowsByKeyword(keyword, showCategory, 0, "view-couint", int(sc.ScopeSettings.ResultCount))
 
-	logger.Println("[Agg]", showType, showCategory)
+	category := reply.RegisterCategory("query_show", fmt.Sprintf(sc.locale.tr("%s 相关%s节目"), keyword, sc.categories.Label(sc.locale, "show", showCategory)), "", queryVideoTemplate.JSON())
 
-	switch showType {
-	case "video":
-		videos := getVideosByCategory(showCategory, "", "today", "view-count", 1, 10)
-		for _, video := range videos {
-			result := scopes.NewCategorisedResult(category)
-			result.SetTitle(video.Title)
-			result.SetArt(video.Thumbnail)
-			result.SetURI(video.Link)
-			result.Set("attributes", []map[string]string{
-				{"value": fmt.Sprintf("🕒%s", formatDuration(video.Duration))},
-				{"value": fmt.Sprintf("🔥%s", formatCount(video.ViewCount))},
-			})
-			result.Set("video_id", video.ID)
-			result.Set("type", "video")
-
-			if err := reply.Push(result); err != nil {
-				logger.Println("[ERROR]", err)
-			}
-		}
-	case "show":
-		shows := getShowsByCategory(showCategory, "", "view-today-count", 1, 10)
-		for _, show := range shows {
+	// Show shows
+	ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(showItems(shows))
+}
 
-			result := scopes.NewCategorisedResult(category)
-
-			result.SetTitle(show.Name)
-			result.SetArt(show.Thumbnail)
-			result.SetURI(show.Link)
-			result.Set("subtitle", fmt.Sprintf("更新 %s", fmt.Sprint(show.EpisodeUpdated)))
-			result.Set("attributes", []map[string]string{
-				{"value": fmt.Sprintf("★%.2f", formatScore(show.Score))},
-				{"value": fmt.Sprintf("🔥%s", formatCount(show.ViewCount))},
-			})
-			result.Set("show_id", show.ID)
-			result.Set("type", "show")
-
-			if err := reply.Push(result); err != nil {
-				logger.Println("[ERROR]", err)
-			}
-		}
+// pushExport pushes the result to export the videos of source as playlists,
+// videos are the ones on screen to be exported
+func (sc *YoukuScope) pushExport(source PlaylistSource, videos []VideoDetail, reply *scopes.SearchReply) {
+	sc.exports.SetListed(source, videos)
+
+	category := reply.RegisterCategory("export", "", "", listCategoryTemplate.JSON())
+	result := scopes.NewCategorisedResult(category)
+	result.SetTitle(sc.locale.tr("导出播放列表"))
+	result.SetArt(sc.base.ScopeDirectory() + "/icon.png")
+	result.SetURI("playlist:export")
+	result.Set("subtitle", "M3U8 / XSPF")
+	result.Set("type", "export")
+	result.Set("export", source)
+	if err := reply.Push(result); err != nil {
+		logger.Println("[ERROR]", err)
 	}
+}
 
+// playlistName returns the name of playlist of source
+func (sc *YoukuScope) playlistName(source PlaylistSource) string {
+	videoCategory, _ := sc.categories.APIValues(ParseDepartmentID(source.DepartmentID))
+	if source.Keyword != "" {
+		return fmt.Sprintf(sc.locale.tr("%s 相关%s视频"), source.Keyword, sc.categories.Label(sc.locale, "video", videoCategory))
+	}
+	name := fmt.Sprintf(sc.locale.tr("%s视频"), sc.categories.Label(sc.locale, "video", videoCategory))
+	return name + " " + time.Now().Format("2006-01-02")
 }
 
-func pushData(data interface{}, category *scopes.Category, reply *scopes.SearchReply) {
+// playlistVideos fetches the videos of source which are not on screen
+func (sc *YoukuScope) playlistVideos(source PlaylistSource) []VideoDetail {
+	videoCategory, videoGenre := sc.categories.APIValues(ParseDepartmentID(source.DepartmentID))
+	count := int(sc.ScopeSettings.ResultCount)
 
-	switch data.(type) {
-	case []Video:
-		videos := data.([]Video)
-		for _, video := range videos {
+	if source.Keyword != "" {
+		return queryVideosByKeyword(source.Keyword, videoCategory, "history", "relevance", count)
+	}
 
-			result := scopes.NewCategorisedResult(category)
+	videos := []VideoDetail{}
+	for _, video := range getVideosByCategory(videoCategory, videoGenre, "today", source.OrderBy, 1, count) {
+		videos = append(videos, VideoDetail{Video: video})
+	}
+	return videos
+}
 
-			result.SetTitle(video.Title)
-			result.SetArt(video.Thumbnail)
-			result.SetURI(video.Link)
-			result.Set("attributes", []map[string]string{
-				{"value": fmt.Sprintf("🕒%s", formatDuration(video.Duration))},
-				{"value": fmt.Sprintf("🔥%s", formatCount(video.ViewCount))},
-			})
-			result.Set("video_id", video.ID)
-			result.Set("type", "video")
+func (sc *YoukuScope) showForAggregatedScopes(query *scopes.CannedQuery, metadata *scopes.SearchMetadata, reply *scopes.SearchReply) {
+	logger.Println("[AGG]", metadata.AggregatedKeywords())
 
-			if err := reply.Push(result); err != nil {
-				logger.Println("[ERROR]", err)
-			}
-		}
-	case []VideoDetail:
-		videos := data.([]VideoDetail)
-		for _, video := range videos {
+	rand.Seed(time.Now().UnixNano())
 
-			result := scopes.NewCategorisedResult(category)
+	queryString := query.QueryString()
+	keywords := metadata.AggregatedKeywords()
 
-			result.SetTitle(video.Title)
-			result.SetArt(video.Thumbnail)
-			result.SetURI(video.Link)
-			result.Set("attributes", []map[string]string{
-				{"value": fmt.Sprintf("🕒%s", formatDuration(video.Duration))},
-				{"value": fmt.Sprintf("🔥%s", formatCount(video.ViewCount))},
-			})
-			result.Set("video_id", video.ID)
-			result.Set("type", "video")
+	if queryString != "" {
+		sources := aggregationSearchSources(sc.aggregation, keywords)
+		category := reply.RegisterCategory("aggregate_query", fmt.Sprintf(sc.locale.tr("%s 相关内容"), queryString), "", queryVideoTemplate.JSON())
+		ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}.Push(searchAggregated(queryString, sources, aggregatedSearchCount))
+		return
+	}
 
-			if err := reply.Push(result); err != nil {
-				logger.Println("[ERROR]", err)
-			}
+	source, ok := pickAggregationSource(sc.aggregation, keywords)
+	if !ok {
+		return
+	}
+	showType, showCategory := source.Type, source.Category
+	if showCategory == "" {
+		categories := sc.categories.Categories(showType)
+		if len(categories) == 0 {
+			return
 		}
-	case []Show:
-		shows := data.([]Show)
-		for _, show := range shows {
+		showCategory = categories[rand.Intn(len(categories))].Label
+	}
 
-			result := scopes.NewCategorisedResult(category)
-
-			result.SetTitle(show.Name)
-			result.SetArt(show.Thumbnail)
-			result.SetURI(show.Link)
-			result.Set("subtitle", fmt.Sprintf("更新 %s", fmt.Sprint(show.EpisodeUpdated)))
-			result.Set("attributes", []map[string]string{
-				{"value": fmt.Sprintf("★%.2f", formatScore(show.Score))},
-				{"value": fmt.Sprintf("🔥%s", formatCount(show.ViewCount))},
-			})
-			result.Set("show_id", show.ID)
-			result.Set("type", "show")
-
-			if err := reply.Push(result); err != nil {
-				logger.Println("[ERROR]", err)
-			}
-		}
+	category := reply.RegisterCategory("aggregate", sc.categories.Label(sc.locale, showType, showCategory), "", categoryTemplate(showType, showCategory))
 
+	logger.Println("[Agg]", showType, showCategory)
+
+	renderer := ResultRenderer{Category: category, Reply: reply, Locale: sc.locale}
+	switch showType {
+	case "video":
+		renderer.Push(videoItems(getVideosByCategory(showCategory, "", source.Period, source.OrderBy, 1, source.Count)))
+	case "show":
+		renderer.Push(showItems(getShowsByCategory(showCategory, "", "", source.OrderBy, 1, source.Count)))
+	}
+
+}
+
+// playStream returns the URI to play video in the preferred quality and its
+// stream type, the stream type is empty if the web page is played
+func (sc *YoukuScope) playStream(video VideoDetail) (string, string) {
+	stream, err := pickStream(sc.Resolver, video, sc.ScopeSettings.Quality)
+	if err != nil {
+		logger.Println("[ERROR]", "resolve", video.ID, err)
+		return video.Link, ""
+	}
+	return stream.URL, stream.Type
+}
+
+// playLabel appends the quality of the stream type to be played to label
+func playLabel(l Locale, label string, streamType string) string {
+	if q := streamTypeQuality(streamType); q != qualityUnknown {
+		return fmt.Sprintf("%s (%s)", label, l.tr(qualityLabels[q]))
 	}
+	return label
+}
 
+func isFromHistory(result *scopes.Result) bool {
+	var history bool
+	result.Get("history", &history)
+	return history
 }
 
-func formatCount(c interface{}) string {
+func (l Locale) formatCount(count FlexInt) string {
 
 	var text string
-	count, _ := strconv.Atoi(fmt.Sprint(c))
 
 	switch {
+	case !l.isChinese() && count > 999999999:
+		text = fmt.Sprintf("%.2fB", float64(count)/1000000000)
+	case !l.isChinese() && count > 999999:
+		text = fmt.Sprintf("%.2fM", float64(count)/1000000)
+	case !l.isChinese() && count > 9999:
+		text = fmt.Sprintf("%.2fK", float64(count)/1000)
 	case count <= 9999:
-		text = fmt.Sprint(count)
+		text = fmt.Sprint(int64(count))
 	case count > 9999 && count <= 99999999:
 		f := float64(count) / 10000
 		text = fmt.Sprintf("%.2f万", f)
@@ -972,31 +1453,14 @@ func formatCount(c interface{}) string {
 	return text
 }
 
-func formatDuration(data interface{}) string {
-	durationString := fmt.Sprint(data)
-	duration, err := strconv.ParseFloat(durationString, 64)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-	} else {
-		hr := 0
-		min := 0
-		sec := 0
-		sec = int(duration) % 60
-		min = int(duration/60) % 60
-		hr = int(duration/3600) % 60
-		if hr == 0 {
-			durationString = fmt.Sprintf("%d:%02d", min, sec)
-		} else {
-			durationString = fmt.Sprintf("%d:%02d:%02d", hr, min, sec)
-		}
+func formatDuration(duration FlexFloat) string {
+	sec := int(duration) % 60
+	min := int(duration/60) % 60
+	hr := int(duration / 3600)
+	if hr == 0 {
+		return fmt.Sprintf("%d:%02d", min, sec)
 	}
-
-	return durationString
-}
-
-func formatScore(s interface{}) float64 {
-	f, _ := strconv.ParseFloat(fmt.Sprint(s), 64)
-	return f
+	return fmt.Sprintf("%d:%02d:%02d", hr, min, sec)
 }
 
 func isContainsKey(key string, keys []string) bool {
@@ -1014,6 +1478,11 @@ func isContainsKey(key string, keys []string) bool {
 
 func main() {
 
+	// youku feed [flags]
+	if len(os.Args) > 1 && os.Args[1] == "feed" {
+		os.Exit(feedCommand(os.Args[2:]))
+	}
+
 	logger.Println("Setting up accounts")
 	watcher := accounts.NewWatcher(accountServiceType, []string{accountService})
 	watcher.Settle()
@@ -1021,6 +1490,7 @@ func main() {
 	logger.Println("Starting scope")
 	scope := &YoukuScope{
 		Accounts: watcher,
+		Resolver: NewPlaylistResolver(3 * time.Second),
 	}
 
 	if err := scopes.Run(scope); err != nil {
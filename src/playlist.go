@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// PlaylistEntry to save a video in playlist
+type PlaylistEntry struct {
+	Title     string
+	Duration  FlexFloat // seconds
+	Location  string
+	Thumbnail string
+}
+
+// PlaylistSource to save the videos listed in the scope to be exported, a
+// search if Keyword is not empty, otherwise a category
+type PlaylistSource struct {
+	Keyword      string `json:"keyword"`
+	DepartmentID string `json:"department_id"`
+	OrderBy      string `json:"orderby"`
+}
+
+// Number of the streams resolved at the same time in an export
+const playlistResolveConcurrency = 4
+
+// playlistEntries turns videos to entries, the streams are resolved by
+// resolver in preferred quality, or the links of web page are used
+func playlistEntries(videos []VideoDetail, resolver StreamResolver, preferred int) []PlaylistEntry {
+	entries := make([]PlaylistEntry, len(videos))
+
+	var wg sync.WaitGroup
+	slots := make(chan bool, playlistResolveConcurrency)
+	for i, video := range videos {
+		entries[i] = PlaylistEntry{
+			Title:     video.Title,
+			Duration:  video.Duration,
+			Location:  video.Link,
+			Thumbnail: video.Thumbnail,
+		}
+		if resolver == nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- true
+		go func(i int, video VideoDetail) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			// the videos of categories come without stream types
+			if len(video.StreamTypes) == 0 {
+				video.StreamTypes = getVideoDetail(video.ID).StreamTypes
+			}
+			entries[i].Location = resolveStream(resolver, video, preferred)
+		}(i, video)
+	}
+	wg.Wait()
+
+	return entries
+}
+
+// writeM3U8 writes entries to w as an extended M3U playlist in UTF-8
+func writeM3U8(w io.Writer, title string, entries []PlaylistEntry) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "#EXTM3U")
+	fmt.Fprintf(b, "#PLAYLIST:%s\n", title)
+	for _, e := range entries {
+		fmt.Fprintf(b, "#EXTINF:%d,%s (%s)\n", int(e.Duration), e.Title, formatDuration(e.Duration))
+		fmt.Fprintln(b, e.Location)
+	}
+	return b.Flush()
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Title      string `xml:"title"`
+	Duration   int64  `xml:"duration,omitempty"` // milliseconds
+	Annotation string `xml:"annotation,omitempty"`
+	Image      string `xml:"image,omitempty"`
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	Date    string      `xml:"date"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// writeXSPF writes entries to w as a XSPF playlist
+func writeXSPF(w io.Writer, title string, entries []PlaylistEntry) error {
+	playlist := xspfPlaylist{
+		Version: "1",
+		XMLNS:   "http://xspf.org/ns/0/",
+		Title:   title,
+		Date:    time.Now().Format(time.RFC3339),
+	}
+	for _, e := range entries {
+		playlist.Tracks = append(playlist.Tracks, xspfTrack{
+			Location:   e.Location,
+			Title:      e.Title,
+			Duration:   int64(e.Duration * 1000),
+			Annotation: formatDuration(e.Duration),
+			Image:      e.Thumbnail,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(playlist); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+var unsafeFileChars = regexp.MustCompile(`[/\\:*?"<>|\s]+`)
+
+// exportPlaylist writes entries to "<name>.m3u8" and "<name>.xspf" in dir,
+// returns the paths of files
+func exportPlaylist(dir, name string, entries []PlaylistEntry) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "_"))
+	writers := []struct {
+		ext   string
+		write func(io.Writer, string, []PlaylistEntry) error
+	}{
+		{".m3u8", writeM3U8},
+		{".xspf", writeXSPF},
+	}
+
+	files := []string{}
+	for _, w := range writers {
+		f, err := os.Create(base + w.ext)
+		if err != nil {
+			return files, err
+		}
+		err = w.write(f, name, entries)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return files, err
+		}
+		files = append(files, base+w.ext)
+	}
+	return files, nil
+}
+
+// PlaylistExport to save the result of exporting a PlaylistSource
+type PlaylistExport struct {
+	Name    string
+	Count   int
+	Files   []string
+	Err     error
+	Running bool
+}
+
+// Number of the lists of videos on screen kept for the exports
+const playlistListedMax = 20
+
+// PlaylistExports keeps the last export of each PlaylistSource, and the
+// videos of the sources last shown to be exported without fetching again
+type PlaylistExports struct {
+	mutex   sync.Mutex
+	exports map[PlaylistSource]PlaylistExport
+	listed  map[PlaylistSource][]VideoDetail
+}
+
+// NewPlaylistExports to create an empty PlaylistExports
+func NewPlaylistExports() *PlaylistExports {
+	return &PlaylistExports{
+		exports: map[PlaylistSource]PlaylistExport{},
+		listed:  map[PlaylistSource][]VideoDetail{},
+	}
+}
+
+// SetListed saves the videos of source shown in the scope
+func (e *PlaylistExports) SetListed(source PlaylistSource, videos []VideoDetail) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.listed[source]; !ok && len(e.listed) >= playlistListedMax {
+		e.listed = map[PlaylistSource][]VideoDetail{}
+	}
+	e.listed[source] = videos
+}
+
+// Listed returns the videos of source last shown in the scope
+func (e *PlaylistExports) Listed(source PlaylistSource) ([]VideoDetail, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	videos, ok := e.listed[source]
+	return videos, ok
+}
+
+// Start marks the export of source running, false if it is running already
+func (e *PlaylistExports) Start(source PlaylistSource, name string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.exports[source].Running {
+		return false
+	}
+	e.exports[source] = PlaylistExport{Name: name, Running: true}
+	return true
+}
+
+// Get returns the last export of source
+func (e *PlaylistExports) Get(source PlaylistSource) (PlaylistExport, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	export, ok := e.exports[source]
+	return export, ok
+}
+
+// Set saves the export of source
+func (e *PlaylistExports) Set(source PlaylistSource, export PlaylistExport) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.exports[source] = export
+}
+
+// playlistDir returns the directory of playlists in cache directory, the
+// files are shared to other apps by the content hub
+func playlistDir(cachePath string) string {
+	return cachePath + "/playlists"
+}
@@ -0,0 +1,93 @@
+package main
+
+// Quality levels of the stream types
+const (
+	qualityUnknown = iota
+	qualitySD
+	qualityHD
+	qualitySHD
+	quality1080P
+)
+
+var qualityLabels = map[int]string{
+	qualitySD:    "标清",
+	qualityHD:    "高清",
+	qualitySHD:   "超清",
+	quality1080P: "1080P",
+}
+
+var streamTypeQualities = map[string]int{
+	"3gp":    qualitySD,
+	"3gphd":  qualitySD,
+	"flv":    qualitySD,
+	"flvhd":  qualitySD,
+	"mp4":    qualityHD,
+	"mp4hd":  qualityHD,
+	"hd":     qualityHD,
+	"hd2":    qualitySHD,
+	"mp4hd2": qualitySHD,
+	"hd3":    quality1080P,
+	"mp4hd3": quality1080P,
+}
+
+func streamTypeQuality(streamType string) int {
+	return streamTypeQualities[streamType]
+}
+
+// bestQuality returns the highest quality of the stream types
+func bestQuality(streamTypes []string) int {
+	best := qualityUnknown
+	for _, t := range streamTypes {
+		if q := streamTypeQuality(t); q > best {
+			best = q
+		}
+	}
+	return best
+}
+
+// qualityAttributes returns the badge of the best quality of the stream
+// types for the attributes of card or header
+func qualityAttributes(l Locale, streamTypes []string) []map[string]string {
+	if q := bestQuality(streamTypes); q != qualityUnknown {
+		return []map[string]string{{"value": l.tr(qualityLabels[q])}}
+	}
+	return []map[string]string{}
+}
+
+// qualities returns the labels of the available qualities from low to high
+func qualities(l Locale, streamTypes []string) []string {
+	labels := []string{}
+	for q := qualitySD; q <= quality1080P; q++ {
+		for _, t := range streamTypes {
+			if streamTypeQuality(t) == q {
+				labels = append(labels, l.tr(qualityLabels[q]))
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// preferredStreamType picks the best stream type not above the preferred
+// quality, or the lowest one above it. The highest one is picked when
+// preferred is qualityUnknown.
+func preferredStreamType(streamTypes []string, preferred int) string {
+	var picked string
+	pickedQuality := qualityUnknown
+	for _, t := range streamTypes {
+		q := streamTypeQuality(t)
+		if q == qualityUnknown {
+			continue
+		}
+		switch {
+		case picked == "":
+		case preferred == qualityUnknown && q > pickedQuality:
+		case preferred != qualityUnknown && pickedQuality > preferred && q < pickedQuality:
+		case preferred != qualityUnknown && q <= preferred && q > pickedQuality:
+		default:
+			continue
+		}
+		picked, pickedQuality = t, q
+	}
+	return picked
+}
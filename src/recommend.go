@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	searchFile    = "/search.json"
+	searchMaxSize = 50
+)
+
+// searchMutex guards the search terms file against concurrent queries
+var searchMutex sync.Mutex
+
+// Weights of the user actions in the affinity profile
+const (
+	historyWeight = 1.0
+	followWeight  = 3.0
+	searchWeight  = 0.5
+)
+
+// SearchTerm to save a keyword searched by user
+type SearchTerm struct {
+	Keyword  string `json:"keyword"`
+	Category string `json:"category,omitempty"`
+	Searched int64  `json:"searched"`
+}
+
+// Affinity is the interest of user in a category (and genre) of videos or shows
+type Affinity struct {
+	Type     string
+	Category string
+	Genre    string
+	Weight   float64
+}
+
+func getSearchTerms(path string) []SearchTerm {
+	searchMutex.Lock()
+	defer searchMutex.Unlock()
+	return loadSearchTerms(path)
+}
+
+func loadSearchTerms(path string) []SearchTerm {
+
+	f, err := ioutil.ReadFile(path + searchFile)
+	if err != nil {
+		return []SearchTerm{}
+	}
+
+	var terms []SearchTerm
+	err = json.Unmarshal(f, &terms)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []SearchTerm{}
+	}
+	return terms
+}
+
+func addSearchTerm(path, keyword, category string) {
+	searchMutex.Lock()
+	defer searchMutex.Unlock()
+
+	terms := append([]SearchTerm{{
+		Keyword:  keyword,
+		Category: category,
+		Searched: time.Now().Unix(),
+	}}, loadSearchTerms(path)...)
+	if len(terms) > searchMaxSize {
+		terms = terms[:searchMaxSize]
+	}
+
+	data, err := json.Marshal(terms)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	tmp := path + searchFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	if err := os.Rename(tmp, path+searchFile); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// getAffinityProfile builds the interests of user from watch history,
+// followed shows and search terms recorded in path
+func getAffinityProfile(path string, categories *CategoryRegistry) []Affinity {
+
+	weights := map[Affinity]float64{}
+	add := func(itemType, category, genre string, weight float64) {
+		if category == "" {
+			return
+		}
+		weights[Affinity{Type: itemType, Category: category, Genre: genre}] += weight
+	}
+
+	// recent actions count more
+	decay := func(t int64) float64 {
+		days := time.Since(time.Unix(t, 0)).Hours() / 24
+		return 1 / (1 + days/7)
+	}
+
+	for _, item := range getHistory(path) {
+		add(item.Type, item.Category, item.Genre, historyWeight*decay(item.Watched))
+	}
+
+	for _, show := range getFollowedShows(path) {
+		add("show", show.Category, show.Genre, followWeight)
+	}
+
+	// match the search terms with categories and genres
+	for _, term := range getSearchTerms(path) {
+		weight := searchWeight * decay(term.Searched)
+		for _, kind := range []string{"video", "show"} {
+			for _, c := range categories.Categories(kind) {
+				if c.Label == term.Category || strings.Contains(term.Keyword, c.Label) {
+					add(kind, c.Label, "", weight)
+				}
+				for _, g := range c.Genres {
+					if strings.Contains(term.Keyword, g.Label) {
+						add(kind, c.Label, g.Label, weight)
+					}
+				}
+			}
+		}
+	}
+
+	profile := []Affinity{}
+	for k, v := range weights {
+		k.Weight = v
+		profile = append(profile, k)
+	}
+	sort.Sort(byWeight(profile))
+	return profile
+}
+
+type byWeight []Affinity
+
+func (a byWeight) Len() int      { return len(a) }
+func (a byWeight) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byWeight) Less(i, j int) bool {
+	if a[i].Weight != a[j].Weight {
+		return a[i].Weight > a[j].Weight
+	}
+	return a[i].Type+a[i].Category+a[i].Genre < a[j].Type+a[j].Category+a[j].Genre
+}
+
+// recommendHomeSection picks a category of videos or shows weighted by the
+// affinity profile, skipping the ones in exclude. It falls back to a random
+// section when there is nothing known about user.
+func recommendHomeSection(profile []Affinity, exclude map[Affinity]bool, categories *CategoryRegistry) HomeSection {
+	rand.Seed(time.Now().UnixNano())
+
+	candidates := []Affinity{}
+	total := 0.0
+	for _, a := range profile {
+		if exclude[Affinity{Type: a.Type, Category: a.Category, Genre: a.Genre}] {
+			continue
+		}
+		if a.Type == "show" && a.Category == "音乐" {
+			continue
+		}
+		candidates = append(candidates, a)
+		total += a.Weight
+	}
+	if len(candidates) == 0 || total <= 0 {
+		return randomHomeSection(categories)
+	}
+
+	pick := candidates[0]
+	r := rand.Float64() * total
+	for _, a := range candidates {
+		if r < a.Weight {
+			pick = a
+			break
+		}
+		r -= a.Weight
+	}
+	exclude[Affinity{Type: pick.Type, Category: pick.Category, Genre: pick.Genre}] = true
+
+	section := HomeSection{
+		Type:        pick.Type,
+		Category:    pick.Category,
+		Genre:       pick.Genre,
+		Template:    "grid",
+		Recommended: true,
+	}
+	return section.withDefaults()
+}
+
+// watchedIDs returns the IDs of the videos and shows in history
+func watchedIDs(path string) map[string]bool {
+	ids := map[string]bool{}
+	for _, item := range getHistory(path) {
+		ids[item.Type+"_"+item.ID] = true
+	}
+	return ids
+}
+
+func firstGenre(genre string) string {
+	return strings.TrimSpace(strings.Split(genre, ",")[0])
+}
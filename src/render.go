@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"launchpad.net/go-unityscopes/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Renderable is an item which can be shown as a result card in locale l
+type Renderable interface {
+	Render(result *scopes.CategorisedResult, l Locale)
+}
+
+// paidEmblem is the icon of the emblem on paid show cards, set with the
+// scope directory
+var paidEmblem string
+
+// ResultRenderer pushes Renderable items to Reply as the results of
+// Category, in Locale of the query
+type ResultRenderer struct {
+	Category *scopes.Category
+	Reply    *scopes.SearchReply
+	Locale   Locale
+}
+
+// Push renders items and pushes them to reply
+func (r ResultRenderer) Push(items []Renderable) {
+	for _, item := range items {
+		result := scopes.NewCategorisedResult(r.Category)
+		item.Render(result, r.Locale)
+		if err := r.Reply.Push(result); err != nil {
+			logger.Println("[ERROR]", err)
+		}
+	}
+}
+
+// Render sets the card of video to result
+func (video Video) Render(result *scopes.CategorisedResult, l Locale) {
+	result.SetTitle(video.Title)
+	result.SetArt(video.Thumbnail)
+	result.SetURI(video.Link)
+	result.Set("attributes", videoAttributes(l, video, nil))
+	result.Set("video_id", video.ID)
+	result.Set("type", "video")
+}
+
+// Render sets the card of video to result with the uploader and the
+// quality badge
+func (video VideoDetail) Render(result *scopes.CategorisedResult, l Locale) {
+	video.Video.Render(result, l)
+	if video.User.Name != "" {
+		result.Set("subtitle", video.User.Name)
+	}
+	result.Set("attributes", videoAttributes(l, video.Video, video.StreamTypes))
+}
+
+// Render sets the card of show to result
+func (show Show) Render(result *scopes.CategorisedResult, l Locale) {
+	result.SetTitle(show.Name)
+	result.SetArt(show.Thumbnail)
+	result.Set("poster", posterOf(show))
+	result.SetURI(show.Link)
+	result.Set("subtitle", showSubtitle(l, show))
+	result.Set("attributes", showAttributes(l, show))
+	if show.Paid != 0 && paidEmblem != "" {
+		result.Set("emblem", paidEmblem)
+	}
+	result.Set("show_id", show.ID)
+	result.Set("type", "show")
+}
+
+// Render sets the card of the video or show watched to result
+func (item HistoryItem) Render(result *scopes.CategorisedResult, l Locale) {
+	result.SetTitle(item.Title)
+	result.SetArt(item.Thumbnail)
+	result.SetURI(item.Link)
+	subtitle := fmt.Sprintf(l.tr("%s 观看"), time.Unix(item.Watched, 0).Format("01-02 15:04"))
+	if item.Episode > 0 {
+		subtitle += fmt.Sprintf(l.tr(" · 第%d集"), item.Episode)
+	}
+	result.Set("subtitle", subtitle)
+	result.Set(item.Type+"_id", item.ID)
+	result.Set("type", item.Type)
+	result.Set("history", true)
+}
+
+// Render sets the card of followed show to result with the new episodes
+func (show FollowedShow) Render(result *scopes.CategorisedResult, l Locale) {
+	result.SetTitle(show.Name)
+	result.SetArt(show.Thumbnail)
+	result.SetURI(show.Link)
+	if show.EpisodeUpdated > 0 {
+		result.Set("subtitle", fmt.Sprintf(l.tr("更新至第%d集"), show.EpisodeUpdated))
+	}
+	if show.HasUpdate() {
+		attributes := []map[string]string{{"value": l.tr("🆕新剧集")}}
+		if show.EpisodeSeen > 0 {
+			attributes = append(attributes, map[string]string{"value": fmt.Sprintf(l.tr("看到第%d集"), show.EpisodeSeen)})
+		}
+		result.Set("attributes", attributes)
+	}
+	result.Set("show_id", show.ID)
+	result.Set("type", "show")
+}
+
+func videoItems(videos []Video) []Renderable {
+	items := make([]Renderable, len(videos))
+	for i, v := range videos {
+		items[i] = v
+	}
+	return items
+}
+
+func videoDetailItems(videos []VideoDetail) []Renderable {
+	items := make([]Renderable, len(videos))
+	for i, v := range videos {
+		items[i] = v
+	}
+	return items
+}
+
+func showItems(shows []Show) []Renderable {
+	items := make([]Renderable, len(shows))
+	for i, v := range shows {
+		items[i] = v
+	}
+	return items
+}
+
+func historyItems(history []HistoryItem) []Renderable {
+	items := make([]Renderable, len(history))
+	for i, v := range history {
+		items[i] = v
+	}
+	return items
+}
+
+func followedShowItems(shows []FollowedShow) []Renderable {
+	items := make([]Renderable, len(shows))
+	for i, v := range shows {
+		items[i] = v
+	}
+	return items
+}
+
+func posterOf(show Show) string {
+	if show.Poster != "" {
+		return show.Poster
+	}
+	return show.Thumbnail
+}
+
+// showSubtitle returns the released year and the update status of show
+// like "2015 · 更新至第12集"
+func showSubtitle(l Locale, show Show) string {
+	parts := []string{}
+	if year := releasedYear(show.Released); year != "" {
+		parts = append(parts, year)
+	}
+	switch {
+	case show.EpisodeCount > 0 && show.EpisodeUpdated >= show.EpisodeCount:
+		parts = append(parts, l.tr("已完结"))
+	case show.EpisodeUpdated > 0:
+		parts = append(parts, fmt.Sprintf(l.tr("更新至第%d集"), show.EpisodeUpdated))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// releasedYear returns the year of a date like "2015-01-02"
+func releasedYear(released string) string {
+	if len(released) < 4 {
+		return ""
+	}
+	if _, err := strconv.Atoi(released[:4]); err != nil {
+		return ""
+	}
+	return released[:4]
+}
+
+// showAttributes returns the badges of show card: score, views and the best
+// quality. Paid shows are marked by the emblem.
+func showAttributes(l Locale, show Show) []map[string]string {
+	attributes := []map[string]string{}
+	if show.Score > 0 {
+		attributes = append(attributes, map[string]string{"value": fmt.Sprintf("★%.1f", show.Score)})
+	}
+	attributes = append(attributes, map[string]string{"value": fmt.Sprintf("🔥%s", l.formatCount(show.ViewCount))})
+	return append(attributes, qualityAttributes(l, show.StreamTypes)...)
+}
+
+// videoAttributes returns the badges of video card: duration, views and the
+// best quality of the stream types
+func videoAttributes(l Locale, video Video, streamTypes []string) []map[string]string {
+	attributes := []map[string]string{
+		{"value": fmt.Sprintf("🕒%s", formatDuration(video.Duration))},
+		{"value": fmt.Sprintf("🔥%s", l.formatCount(video.ViewCount))},
+	}
+	return append(attributes, qualityAttributes(l, streamTypes)...)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"launchpad.net/go-unityscopes/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of the top shows to rank by growth
+const risingCount = 20
+
+// RisingShow is a show with the growth of views
+type RisingShow struct {
+	ShowDetail
+	Growth float64 // 0.5 means 50% more views than the average of last week
+}
+
+// Render sets the card of show to result with the growth
+func (s RisingShow) Render(result *scopes.CategorisedResult, l Locale) {
+	s.Show.Render(result, l)
+
+	growth := fmt.Sprintf("↑%.0f%%", s.Growth*100)
+	if s.Growth < 0 {
+		growth = fmt.Sprintf("↓%.0f%%", -s.Growth*100)
+	}
+	attributes := append([]map[string]string{{"value": growth}}, showAttributes(l, s.Show)...)
+	result.Set("attributes", attributes)
+}
+
+type byGrowth []RisingShow
+
+func (a byGrowth) Len() int           { return len(a) }
+func (a byGrowth) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byGrowth) Less(i, j int) bool { return a[i].Growth > a[j].Growth }
+
+// Number of the shows fetched at the same time
+const risingDetailConcurrency = 4
+
+// getRisingShows ranks the top count shows of category by the growth of
+// views, and records the view counts in stats
+func getRisingShows(stats *StatsStore, category, genre, area string, count int) []RisingShow {
+
+	shows := getShowsByCategory(category, genre, area, "view-today-count", 1, count)
+
+	details := make([]ShowDetail, len(shows))
+	var wg sync.WaitGroup
+	slots := make(chan bool, risingDetailConcurrency)
+	for i, show := range shows {
+		wg.Add(1)
+		slots <- true
+		go func(i int, id string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			details[i] = getShowDetail(id)
+		}(i, show.ID)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	points := map[string]StatPoint{}
+	rising := []RisingShow{}
+	for _, show := range details {
+		if show.ID == "" {
+			continue
+		}
+		key := "show_" + show.ID
+		rising = append(rising, RisingShow{
+			ShowDetail: show,
+			Growth:     showGrowth(show, stats.Get(key), now),
+		})
+		points[key] = StatPoint{Time: now.Unix(), ViewCount: show.ViewCount, Score: show.Score}
+	}
+	stats.Record(points)
+
+	sort.Stable(byGrowth(rising))
+	return rising
+}
+
+// showGrowth compares the views of show in the last day to the daily
+// average of last week. The views of the last day are computed from the
+// snapshot about one day ago if there is one, otherwise the views of
+// yesterday are used.
+func showGrowth(show ShowDetail, history []StatPoint, now time.Time) float64 {
+	average := float64(show.ViewWeekCount) / 7
+	if average <= 0 {
+		return 0
+	}
+
+	daily := float64(show.ViewYesterdayCount)
+
+	// the snapshot nearest to one day ago, at least one hour old
+	day := int64(24 * time.Hour / time.Second)
+	var base *StatPoint
+	for i, p := range history {
+		elapsed := now.Unix() - p.Time
+		if elapsed < int64(statsInterval/time.Second) {
+			continue
+		}
+		if base == nil || abs64(elapsed-day) < abs64(now.Unix()-base.Time-day) {
+			base = &history[i]
+		}
+	}
+	if base != nil && show.ViewCount >= base.ViewCount {
+		elapsed := now.Unix() - base.Time
+		daily = float64(show.ViewCount-base.ViewCount) * float64(day) / float64(elapsed)
+	}
+
+	return daily/average - 1
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -3,46 +3,52 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 )
 
 // Show information in Youku
 type Show struct {
-	ID             string      `json:"id"`
-	Name           string      `json:"name"`
-	Link           string      `json:"link"`
-	PlayLink       string      `json:"play_link"`
-	LastPlayLink   string      `json:"last_play_link"`
-	Poster         string      `json:"poster"`
-	Thumbnail      string      `json:"thumbnail"`
-	SteamTypes     []string    `json:"streamtypes"`
-	EpisodeCount   interface{} `json:"episode_count"`
-	EpisodeUpdated interface{} `json:"episode_updated"`
-	ViewCount      interface{} `json:"view_count"`
-	Score          interface{} `json:"score"`
-	Paid           int         `json:"paid"`
-	Released       string      `json:"released"`
-	Published      string      `json:"published"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Link           string    `json:"link"`
+	PlayLink       string    `json:"play_link"`
+	LastPlayLink   string    `json:"last_play_link"`
+	Poster         string    `json:"poster"`
+	Thumbnail      string    `json:"thumbnail"`
+	StreamTypes    []string  `json:"streamtypes"`
+	EpisodeCount   FlexInt   `json:"episode_count"`
+	EpisodeUpdated FlexInt   `json:"episode_updated"`
+	ViewCount      FlexInt   `json:"view_count"`
+	Score          FlexFloat `json:"score"`
+	Paid           int       `json:"paid"`
+	Released       string    `json:"released"`
+	Published      string    `json:"published"`
 }
 
 // ShowDetail to save detail information of show
 type ShowDetail struct {
 	Show
-	PosterLarge        string      `json:"poster_large"`
-	ThumbnailLarge     string      `json:"thumbnail_large"`
-	Genre              string      `json:"genre"`
-	Area               string      `json:"area"` // allow empty
-	Category           string      `json:"category"`
-	Description        string      `json:"description"` // allow empty
-	Rank               interface{} `json:"rank"`
-	ViewYesterdayCount interface{} `json:"view_yesterday_count"`
-	ViewWeekCount      interface{} `json:"view_week_count"`
-	CommentCount       interface{} `json:"comment_count"`
-	FavoriteCount      interface{} `json:"favorite_count"`
-	UpCount            interface{} `json:"up_count"`
-	DownCount          interface{} `json:"down_count"`
+	PosterLarge        string  `json:"poster_large"`
+	ThumbnailLarge     string  `json:"thumbnail_large"`
+	Genre              string  `json:"genre"`
+	Area               string  `json:"area"` // allow empty
+	Category           string  `json:"category"`
+	Description        string  `json:"description"` // allow empty
+	Rank               FlexInt `json:"rank"`
+	ViewYesterdayCount FlexInt `json:"view_yesterday_count"`
+	ViewWeekCount      FlexInt `json:"view_week_count"`
+	CommentCount       FlexInt `json:"comment_count"`
+	FavoriteCount      FlexInt `json:"favorite_count"`
+	UpCount            FlexInt `json:"up_count"`
+	DownCount          FlexInt `json:"down_count"`
+}
+
+// ShowVideo to save a video of show
+type ShowVideo struct {
+	Video
+	Sequence FlexInt `json:"seq"`
+	Stage    FlexInt `json:"stage"`
 }
 
 // ShowCategory to save categories of shows
@@ -60,33 +66,31 @@ type ShowGenre struct {
 	Lang  string `json:"lang"`
 }
 
-func getShowCategories(path string) []ShowCategory {
-
-	f, err := ioutil.ReadFile(path + "/data/category.json")
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return []ShowCategory{}
-	}
-
-	var data struct {
-		Show []ShowCategory
-	}
-
-	err = json.Unmarshal(f, &data)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return []ShowCategory{}
+// getShowCategories returns the categories from Youku merged over the
+// bundled data/category.json
+func getShowCategories(scopePath, cachePath string) []ShowCategory {
+	categories := []ShowCategory{}
+	for _, raw := range loadCategories("show", scopePath, cachePath) {
+		var c ShowCategory
+		if err := json.Unmarshal(raw, &c); err != nil {
+			logger.Println("[ERROR]", err)
+			continue
+		}
+		categories = append(categories, c)
 	}
-	return data.Show
+	return categories
 }
 
-func getShowsByCategory(category, genre, orderby string, page, count int) []Show {
+func getShowsByCategory(category, genre, area, orderby string, page, count int) []Show {
 
 	api := baseAPI + "shows/by_category.json"
 	v := &url.Values{}
 	v.Set("client_id", clientID)
 	v.Set("category", category)
 	v.Set("genre", genre)
+	if area != "" {
+		v.Set("area", area)
+	}
 	v.Set("orderby", orderby)
 	v.Set("page", fmt.Sprint(page))
 	v.Set("count", fmt.Sprint(count))
@@ -109,7 +113,9 @@ func getShowsByCategory(category, genre, orderby string, page, count int) []Show
 	}
 
 	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&data)
+	if err := decoder.Decode(&data); err != nil {
+		logger.Println("[ERROR]", "json parse", err)
+	}
 
 	return data.Shows
 }
@@ -169,7 +175,69 @@ func queryShowsByKeyword(keyword, category string, unite int, orderby string, co
 	}
 
 	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&data)
+	if err := decoder.Decode(&data); err != nil {
+		logger.Println("[ERROR]", "json parse", err)
+	}
 
 	return data.Shows
 }
+
+func getShowVideos(showID, videoType, orderby string, page, count int) []ShowVideo {
+	api := baseAPI + "shows/videos.json"
+	v := &url.Values{}
+	v.Set("client_id", clientID)
+	v.Set("show_id", showID)
+	v.Set("show_videotype", videoType)
+	v.Set("orderby", orderby)
+	v.Set("page", fmt.Sprint(page))
+	v.Set("count", fmt.Sprint(count))
+
+	api += "?" + v.Encode()
+
+	res, err := http.Get(api)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []ShowVideo{}
+	}
+	defer res.Body.Close()
+
+	var data struct {
+		Total  int
+		Videos []ShowVideo `json:"videos"`
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	if err := decoder.Decode(&data); err != nil {
+		logger.Println("[ERROR]", "json parse", err)
+	}
+
+	return data.Videos
+}
+
+// getAdjacentEpisodes returns the previous and next episodes of the
+// episode with sequence seq in show
+func getAdjacentEpisodes(showID string, seq FlexInt) (prev, next ShowVideo) {
+	if seq <= 0 {
+		return
+	}
+
+	const count = 20
+	pages := map[int]bool{}
+	for _, s := range []FlexInt{seq - 1, seq + 1} {
+		if s > 0 {
+			pages[int(s-1)/count+1] = true
+		}
+	}
+
+	for page := range pages {
+		for _, video := range getShowVideos(showID, "正片", "videoseq-asc", page, count) {
+			switch video.Sequence {
+			case seq - 1:
+				prev = video
+			case seq + 1:
+				next = video
+			}
+		}
+	}
+	return
+}
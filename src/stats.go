@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	statsFile       = "/stats.jsonl"
+	legacyStatsFile = "/stats.json"
+	statsInterval   = time.Hour
+	statsMaxAge     = 30 * 24 * time.Hour
+)
+
+// StatPoint to save a snapshot of the statistics of a video or show
+type StatPoint struct {
+	Time      int64     `json:"time"`
+	Ranking   string    `json:"ranking,omitempty"` // like "video/音乐/view-count"
+	Rank      int       `json:"rank,omitempty"`
+	ViewCount FlexInt   `json:"view_count"`
+	Score     FlexFloat `json:"score,omitempty"`
+}
+
+// statsData maps "<type>_<id>" to the snapshots in time order
+type statsData map[string][]StatPoint
+
+// statRecord is a line of the stats file
+type statRecord struct {
+	Key string `json:"key"`
+	StatPoint
+}
+
+// StatsStore keeps the snapshots in memory. The new snapshots are appended
+// to the stats file on Flush, which is compacted when it is loaded.
+type StatsStore struct {
+	path    string
+	mutex   sync.Mutex
+	data    statsData
+	pending []statRecord
+}
+
+// NewStatsStore to create a StatsStore with the stats file in path
+func NewStatsStore(path string) *StatsStore {
+	s := &StatsStore{path: path, data: statsData{}}
+	s.load()
+	return s
+}
+
+func (s *StatsStore) load() {
+	expired := time.Now().Add(-statsMaxAge).Unix()
+	compact := false
+
+	// the snapshots of old versions in a single JSON file
+	if f, err := ioutil.ReadFile(s.path + legacyStatsFile); err == nil {
+		legacy := statsData{}
+		if err := json.Unmarshal(f, &legacy); err != nil {
+			logger.Println("[ERROR]", err)
+		}
+		for key, history := range legacy {
+			s.data[key] = history
+		}
+		os.Remove(s.path + legacyStatsFile)
+		compact = true
+	}
+
+	f, err := os.Open(s.path + statsFile)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record statRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				// a line cut by a crash
+				compact = true
+				continue
+			}
+			s.data[record.Key] = append(s.data[record.Key], record.StatPoint)
+		}
+		if err := scanner.Err(); err != nil {
+			logger.Println("[ERROR]", err)
+		}
+		f.Close()
+	}
+
+	for key, history := range s.data {
+		i := 0
+		for i < len(history) && history[i].Time < expired {
+			i++
+		}
+		if i == 0 {
+			continue
+		}
+		compact = true
+		if i == len(history) {
+			delete(s.data, key)
+		} else {
+			s.data[key] = history[i:]
+		}
+	}
+
+	if compact {
+		s.rewrite()
+	}
+}
+
+// rewrite writes all the snapshots in memory to the stats file
+func (s *StatsStore) rewrite() {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for key, history := range s.data {
+		for _, point := range history {
+			if err := encoder.Encode(statRecord{Key: key, StatPoint: point}); err != nil {
+				logger.Println("[ERROR]", err)
+				return
+			}
+		}
+	}
+	tmp := s.path + statsFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path+statsFile); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+// Get returns the snapshots of key like "show_<id>"
+func (s *StatsStore) Get(key string) []StatPoint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history := make([]StatPoint, len(s.data[key]))
+	copy(history, s.data[key])
+	return history
+}
+
+// Record adds the snapshots in points, at most one in statsInterval for
+// each key and ranking. They are saved on Flush.
+func (s *StatsStore) Record(points map[string]StatPoint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().Unix()
+	for key, point := range points {
+		if point.Time == 0 {
+			point.Time = now
+		}
+		history := s.data[key]
+		if last := lastStatOf(history, point.Ranking); last != nil && point.Time-last.Time < int64(statsInterval/time.Second) {
+			continue
+		}
+		s.data[key] = append(history, point)
+		s.pending = append(s.pending, statRecord{Key: key, StatPoint: point})
+	}
+}
+
+// Flush appends the snapshots recorded since the last Flush to the stats
+// file in a single write
+func (s *StatsStore) Flush() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.pending) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range s.pending {
+		if err := encoder.Encode(record); err != nil {
+			logger.Println("[ERROR]", err)
+			return
+		}
+	}
+	s.pending = nil
+
+	f, err := os.OpenFile(s.path+statsFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		logger.Println("[ERROR]", err)
+	}
+}
+
+func lastStatOf(history []StatPoint, ranking string) *StatPoint {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Ranking == ranking {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// videoRankingStats returns the snapshots of videos in ranking
+func videoRankingStats(ranking string, videos []Video) map[string]StatPoint {
+	points := map[string]StatPoint{}
+	for i, video := range videos {
+		points["video_"+video.ID] = StatPoint{Ranking: ranking, Rank: i + 1, ViewCount: video.ViewCount}
+	}
+	return points
+}
+
+// showRankingStats returns the snapshots of shows in ranking
+func showRankingStats(ranking string, shows []Show) map[string]StatPoint {
+	points := map[string]StatPoint{}
+	for i, show := range shows {
+		points["show_"+show.ID] = StatPoint{Ranking: ranking, Rank: i + 1, ViewCount: show.ViewCount, Score: show.Score}
+	}
+	return points
+}
+
+// rankingName returns the name of ranking of stats like "show/电影/view-count"
+func rankingName(kind, category, genre, orderby string) string {
+	if genre != "" {
+		category += "/" + genre
+	}
+	return kind + "/" + category + "/" + orderby
+}
+
+// primaryRanking returns the ranking with the most snapshots in history
+// since from, the latest one if there is a tie
+func primaryRanking(history []StatPoint, from time.Time) string {
+	counts := map[string]int{}
+	ranking := ""
+	for _, p := range history {
+		if p.Ranking == "" || p.Rank <= 0 || time.Unix(p.Time, 0).Before(from) {
+			continue
+		}
+		counts[p.Ranking]++
+		if counts[p.Ranking] >= counts[ranking] {
+			ranking = p.Ranking
+		}
+	}
+	return ranking
+}
+
+// statsTable returns the rows of the snapshots of the last days, one row
+// for each day: date, the best rank, views and the growth of views. The
+// ranks are of the returned ranking, the one the item is seen most in.
+func statsTable(l Locale, history []StatPoint, days int, now time.Time) ([][]string, string) {
+	type dayStats struct {
+		date  string
+		rank  int
+		views FlexInt
+	}
+
+	from := now.AddDate(0, 0, -days+1)
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+
+	ranking := primaryRanking(history, from)
+
+	stats := []dayStats{}
+	for _, p := range history {
+		t := time.Unix(p.Time, 0)
+		if t.Before(from) {
+			continue
+		}
+		date := t.Format("01-02")
+		if n := len(stats); n == 0 || stats[n-1].date != date {
+			stats = append(stats, dayStats{date: date})
+		}
+		day := &stats[len(stats)-1]
+		if p.Ranking == ranking && p.Rank > 0 && (day.rank == 0 || p.Rank < day.rank) {
+			day.rank = p.Rank
+		}
+		if p.ViewCount > day.views {
+			day.views = p.ViewCount
+		}
+	}
+
+	rows := [][]string{}
+	for i, day := range stats {
+		rank, growth := "-", "-"
+		if day.rank > 0 {
+			rank = fmt.Sprintf("#%d", day.rank)
+		}
+		if i > 0 && stats[i-1].views > 0 && day.views >= stats[i-1].views {
+			growth = "+" + l.formatCount(day.views-stats[i-1].views)
+		}
+		rows = append(rows, []string{day.date, rank, l.formatCount(day.views), growth})
+	}
+	return rows, ranking
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The best rank of a day is of one ranking, the one seen most
+func TestStatsTableRanking(t *testing.T) {
+	now := time.Date(2015, 5, 3, 20, 0, 0, 0, time.Local)
+	at := func(day, hour int) int64 {
+		return time.Date(2015, 5, day, hour, 0, 0, 0, time.Local).Unix()
+	}
+	history := []StatPoint{
+		{Time: at(2, 9), Ranking: "show/电影/view-count", Rank: 5, ViewCount: 100},
+		{Time: at(2, 10), Ranking: "show/电影/score", Rank: 1, ViewCount: 110},
+		{Time: at(3, 9), Ranking: "show/电影/view-count", Rank: 3, ViewCount: 150},
+		{Time: at(3, 10), ViewCount: 160},
+	}
+
+	rows, ranking := statsTable(Locale{}, history, 7, now)
+	if ranking != "show/电影/view-count" {
+		t.Errorf("ranking = %q", ranking)
+	}
+	want := [][]string{
+		{"05-02", "#5", "110", "-"},
+		{"05-03", "#3", "160", "+50"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+
+	if _, ranking := statsTable(Locale{}, history[3:], 7, now); ranking != "" {
+		t.Errorf("ranking without ranks = %q", ranking)
+	}
+}
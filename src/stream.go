@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream is a media URL of video which can be played directly
+type Stream struct {
+	VideoID string
+	Type    string // stream type like "mp4", "hd2"
+	Format  string // m3u8 or mp4
+	URL     string
+}
+
+// StreamResolver resolves the streams of video in the stream types, and
+// checks if a stream can be played
+type StreamResolver interface {
+	Resolve(videoID string, streamTypes []string) ([]Stream, error)
+	Check(stream Stream) error
+}
+
+// ErrNoStream is returned when there is no stream of video
+var ErrNoStream = errors.New("no stream")
+
+// playlistAPI is the HLS playlist service of Youku
+const playlistAPI = "http://pl.youku.com/playlist/m3u8"
+
+// playlistTypes maps the stream types to the types of playlist service
+var playlistTypes = map[string]string{
+	"flv":    "flv",
+	"flvhd":  "flv",
+	"mp4":    "mp4",
+	"mp4hd":  "mp4",
+	"hd":     "mp4",
+	"hd2":    "hd2",
+	"mp4hd2": "hd2",
+	"hd3":    "hd3",
+	"mp4hd3": "hd3",
+}
+
+const (
+	// the time to keep the result of checking a stream
+	streamCheckTTL = 10 * time.Minute
+	// the time to fail the checks at once after a network error
+	streamOfflineTTL = time.Minute
+)
+
+type streamCheck struct {
+	err  error
+	time time.Time
+}
+
+// PlaylistResolver resolves the HLS playlists of video
+type PlaylistResolver struct {
+	Client *http.Client
+
+	mutex        sync.Mutex
+	checks       map[string]streamCheck
+	offline      error
+	offlineSince time.Time
+}
+
+// NewPlaylistResolver to create a PlaylistResolver with timeout
+func NewPlaylistResolver(timeout time.Duration) *PlaylistResolver {
+	return &PlaylistResolver{
+		Client: &http.Client{Timeout: timeout},
+		checks: map[string]streamCheck{},
+	}
+}
+
+// Resolve returns the playlist of each stream type
+func (r *PlaylistResolver) Resolve(videoID string, streamTypes []string) ([]Stream, error) {
+	streams := []Stream{}
+	for _, t := range streamTypes {
+		playlistType, ok := playlistTypes[t]
+		if !ok {
+			continue
+		}
+		v := &url.Values{}
+		v.Set("vid", videoID)
+		v.Set("type", playlistType)
+		v.Set("ts", fmt.Sprint(time.Now().Unix()))
+		streams = append(streams, Stream{
+			VideoID: videoID,
+			Type:    t,
+			Format:  "m3u8",
+			URL:     playlistAPI + "?" + v.Encode(),
+		})
+	}
+	if len(streams) == 0 {
+		return nil, ErrNoStream
+	}
+	return streams, nil
+}
+
+// Check returns an error if the playlist of stream is not valid. The
+// results are kept for streamCheckTTL, and after a network error the
+// checks fail at once for streamOfflineTTL.
+func (r *PlaylistResolver) Check(stream Stream) error {
+	key := stream.VideoID + "/" + playlistTypes[stream.Type]
+	now := time.Now()
+
+	r.mutex.Lock()
+	if r.offline != nil && now.Sub(r.offlineSince) < streamOfflineTTL {
+		err := r.offline
+		r.mutex.Unlock()
+		return err
+	}
+	if c, ok := r.checks[key]; ok && now.Sub(c.time) < streamCheckTTL {
+		r.mutex.Unlock()
+		return c.err
+	}
+	r.mutex.Unlock()
+
+	err := r.check(stream.URL)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch err.(type) {
+	case *url.Error, net.Error:
+		r.offline, r.offlineSince = err, now
+		return err
+	}
+	r.offline = nil
+	for k, c := range r.checks {
+		if now.Sub(c.time) >= streamCheckTTL {
+			delete(r.checks, k)
+		}
+	}
+	r.checks[key] = streamCheck{err: err, time: now}
+	return err
+}
+
+func (r *PlaylistResolver) check(playlist string) error {
+	res, err := r.Client.Get(playlist)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("playlist: %s", res.Status)
+	}
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), "#EXTM3U") {
+		return fmt.Errorf("playlist: invalid content")
+	}
+	return nil
+}
+
+// pickStream resolves the streams of video and picks the one in the
+// preferred quality, which is checked to be playable
+func pickStream(resolver StreamResolver, video VideoDetail, preferred int) (Stream, error) {
+	if resolver == nil {
+		return Stream{}, ErrNoStream
+	}
+
+	streams, err := resolver.Resolve(video.ID, video.StreamTypes)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	types := make([]string, len(streams))
+	for i, s := range streams {
+		types[i] = s.Type
+	}
+	stream := streams[0]
+	picked := preferredStreamType(types, preferred)
+	for _, s := range streams {
+		if s.Type == picked {
+			stream = s
+			break
+		}
+	}
+	if err := resolver.Check(stream); err != nil {
+		return Stream{}, err
+	}
+	return stream, nil
+}
+
+// resolveStream returns the URL of the stream of video in the preferred
+// quality. The link of web page is returned if it fails.
+func resolveStream(resolver StreamResolver, video VideoDetail, preferred int) string {
+	stream, err := pickStream(resolver, video, preferred)
+	if err != nil {
+		logger.Println("[ERROR]", "resolve", video.ID, err)
+		return video.Link
+	}
+	return stream.URL
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// FakeResolver returns the fixed streams of videos
+type FakeResolver struct {
+	Streams map[string][]Stream
+	Err     error
+	// the errors of Check by stream type
+	CheckErrs map[string]error
+}
+
+// Resolve returns the streams of videoID in streamTypes
+func (r FakeResolver) Resolve(videoID string, streamTypes []string) ([]Stream, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	streams := []Stream{}
+	for _, s := range r.Streams[videoID] {
+		if len(streamTypes) == 0 || isContainsKey(s.Type, streamTypes) {
+			streams = append(streams, s)
+		}
+	}
+	if len(streams) == 0 {
+		return nil, ErrNoStream
+	}
+	return streams, nil
+}
+
+// Check returns the error of the type of stream
+func (r FakeResolver) Check(stream Stream) error {
+	return r.CheckErrs[stream.Type]
+}
+
+func TestPreferredStreamType(t *testing.T) {
+	tests := []struct {
+		types     []string
+		preferred int
+		want      string
+	}{
+		{[]string{"flvhd", "mp4", "hd2"}, qualityUnknown, "hd2"},
+		{[]string{"flvhd", "mp4", "hd2"}, qualityHD, "mp4"},
+		{[]string{"flvhd", "mp4", "hd2"}, qualitySD, "flvhd"},
+		{[]string{"flvhd", "mp4", "hd2"}, quality1080P, "hd2"},
+		// the lowest one if all are above the preferred
+		{[]string{"hd3", "hd2"}, qualitySD, "hd2"},
+		{[]string{"unknown"}, qualityHD, ""},
+		{nil, qualityHD, ""},
+	}
+	for _, test := range tests {
+		if got := preferredStreamType(test.types, test.preferred); got != test.want {
+			t.Errorf("preferredStreamType(%v, %d) = %q, want %q", test.types, test.preferred, got, test.want)
+		}
+	}
+}
+
+func testVideo() VideoDetail {
+	video := VideoDetail{StreamTypes: []string{"flvhd", "mp4", "hd2"}}
+	video.ID = "XMTIzNDU2"
+	video.Link = "http://v.youku.com/v_show/id_XMTIzNDU2.html"
+	return video
+}
+
+func testResolver() FakeResolver {
+	return FakeResolver{Streams: map[string][]Stream{
+		"XMTIzNDU2": {
+			{VideoID: "XMTIzNDU2", Type: "flvhd", Format: "m3u8", URL: "http://example.com/flvhd.m3u8"},
+			{VideoID: "XMTIzNDU2", Type: "mp4", Format: "m3u8", URL: "http://example.com/mp4.m3u8"},
+			{VideoID: "XMTIzNDU2", Type: "hd2", Format: "m3u8", URL: "http://example.com/hd2.m3u8"},
+		},
+	}}
+}
+
+func TestPickStream(t *testing.T) {
+	resolver := testResolver()
+	video := testVideo()
+
+	tests := []struct {
+		preferred int
+		want      string
+	}{
+		{qualityUnknown, "hd2"},
+		{qualitySD, "flvhd"},
+		{qualityHD, "mp4"},
+		{qualitySHD, "hd2"},
+	}
+	for _, test := range tests {
+		stream, err := pickStream(resolver, video, test.preferred)
+		if err != nil {
+			t.Errorf("pickStream(%d): %v", test.preferred, err)
+			continue
+		}
+		if stream.Type != test.want {
+			t.Errorf("pickStream(%d) = %q, want %q", test.preferred, stream.Type, test.want)
+		}
+	}
+
+	if _, err := pickStream(nil, video, qualityHD); err != ErrNoStream {
+		t.Errorf("pickStream without resolver: %v", err)
+	}
+}
+
+func TestResolveStream(t *testing.T) {
+	video := testVideo()
+	broken := errors.New("playlist: 404 Not Found")
+
+	tests := []struct {
+		name      string
+		resolver  StreamResolver
+		preferred int
+		want      string
+	}{
+		{"preferred", testResolver(), qualityHD, "http://example.com/mp4.m3u8"},
+		{"no resolver", nil, qualityHD, video.Link},
+		{"resolve error", FakeResolver{Err: broken}, qualityHD, video.Link},
+		{"no stream", FakeResolver{}, qualityHD, video.Link},
+		// the picked stream is broken even if the others are fine
+		{"check error", FakeResolver{
+			Streams:   testResolver().Streams,
+			CheckErrs: map[string]error{"mp4": broken},
+		}, qualityHD, video.Link},
+		{"other broken", FakeResolver{
+			Streams:   testResolver().Streams,
+			CheckErrs: map[string]error{"flvhd": broken},
+		}, qualityHD, "http://example.com/mp4.m3u8"},
+	}
+	for _, test := range tests {
+		if got := resolveStream(test.resolver, video, test.preferred); got != test.want {
+			t.Errorf("%s: resolveStream = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPlaylistResolverCheck(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("type") == "hd2" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "#EXTM3U")
+	}))
+
+	resolver := NewPlaylistResolver(time.Second)
+	good := Stream{VideoID: "1", Type: "mp4", URL: server.URL + "?type=mp4"}
+	bad := Stream{VideoID: "1", Type: "hd2", URL: server.URL + "?type=hd2"}
+
+	if err := resolver.Check(good); err != nil {
+		t.Errorf("check good stream: %v", err)
+	}
+	if err := resolver.Check(bad); err == nil {
+		t.Errorf("check broken stream: no error")
+	}
+	// the results are kept
+	resolver.Check(good)
+	resolver.Check(bad)
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+
+	// the checks fail at once when offline
+	server.Close()
+	other := Stream{VideoID: "2", Type: "mp4", URL: good.URL}
+	if err := resolver.Check(other); err == nil {
+		t.Errorf("check when offline: no error")
+	}
+	other.VideoID = "3"
+	start := time.Now()
+	if err := resolver.Check(other); err == nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("check again when offline: %v in %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CategoryTemplate is the template of a category in the scope category
+// schema, see JSON for the serialized form
+type CategoryTemplate struct {
+	Layout         string // category-layout
+	CardLayout     string // card-layout
+	CardSize       string // card-size
+	CardBackground string // card-background
+	Overlay        bool
+	Components     Components
+}
+
+// Components maps the fields of result to the card components
+type Components struct {
+	Title      string        `json:"title,omitempty"`
+	Subtitle   string        `json:"subtitle,omitempty"`
+	Art        *ArtComponent `json:"art,omitempty"`
+	Mascot     string        `json:"mascot,omitempty"`
+	Emblem     string        `json:"emblem,omitempty"`
+	Summary    string        `json:"summary,omitempty"`
+	Attributes string        `json:"attributes,omitempty"`
+}
+
+// ArtComponent is the art component of card
+type ArtComponent struct {
+	Field       string  `json:"field,omitempty"`
+	AspectRatio float64 `json:"aspect-ratio,omitempty"`
+	FillMode    string  `json:"fill-mode,omitempty"`
+}
+
+const templateSchemaVersion = 1
+
+// JSON serializes the template to be registered with the category
+func (t CategoryTemplate) JSON() string {
+	data := struct {
+		SchemaVersion int `json:"schema-version"`
+		Template      struct {
+			CategoryLayout string `json:"category-layout"`
+			CardLayout     string `json:"card-layout,omitempty"`
+			CardSize       string `json:"card-size,omitempty"`
+			CardBackground string `json:"card-background,omitempty"`
+			Overlay        bool   `json:"overlay,omitempty"`
+		} `json:"template"`
+		Components Components `json:"components"`
+	}{
+		SchemaVersion: templateSchemaVersion,
+		Components:    t.Components,
+	}
+	data.Template.CategoryLayout = t.Layout
+	data.Template.CardLayout = t.CardLayout
+	data.Template.CardSize = t.CardSize
+	data.Template.CardBackground = t.CardBackground
+	data.Template.Overlay = t.Overlay
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return ""
+	}
+	return string(b)
+}
+
+// Validate checks the template against the scope category schema
+func (t CategoryTemplate) Validate() error {
+	switch t.Layout {
+	case "grid", "carousel", "vertical-journal", "horizontal-list":
+	default:
+		return fmt.Errorf("unknown category-layout %q", t.Layout)
+	}
+	switch t.CardLayout {
+	case "", "vertical", "horizontal":
+	default:
+		return fmt.Errorf("unknown card-layout %q", t.CardLayout)
+	}
+	if t.Layout == "carousel" && t.CardLayout == "horizontal" {
+		return fmt.Errorf("carousel does not support horizontal card-layout")
+	}
+	switch t.CardSize {
+	case "", "small", "medium", "large":
+	default:
+		return fmt.Errorf("unknown card-size %q", t.CardSize)
+	}
+	if t.CardBackground != "" && !strings.HasPrefix(t.CardBackground, "color:///") && !strings.HasPrefix(t.CardBackground, "gradient:///") {
+		return fmt.Errorf("invalid card-background %q", t.CardBackground)
+	}
+
+	c := t.Components
+	if c.Title == "" {
+		return fmt.Errorf("missing title component")
+	}
+	if c.Art == nil {
+		if t.Layout == "carousel" || t.Overlay {
+			return fmt.Errorf("%s requires art component", t.Layout)
+		}
+		return nil
+	}
+	if c.Art.AspectRatio <= 0 {
+		return fmt.Errorf("invalid art aspect-ratio %v", c.Art.AspectRatio)
+	}
+	switch c.Art.FillMode {
+	case "", "crop", "fit":
+	default:
+		return fmt.Errorf("unknown art fill-mode %q", c.Art.FillMode)
+	}
+	return nil
+}
+
+// Card sizes in settings
+var itemSizes = []string{"large", "medium", "small"}
+
+var (
+	homeCategoryTemplate = CategoryTemplate{
+		Layout:   "carousel",
+		CardSize: "large",
+		Overlay:  true,
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "art", AspectRatio: 1.4},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+
+	largeVideoCategoryTemplate = CategoryTemplate{
+		Layout:   "vertical-journal",
+		CardSize: "large",
+		Overlay:  true,
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "art", AspectRatio: 2.5},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+
+	loginNagTemplate = CategoryTemplate{
+		Layout:         "vertical-journal",
+		CardSize:       "large",
+		CardBackground: "color:///#06A7E1",
+		Components: Components{
+			Title: "title",
+			Art:   &ArtComponent{AspectRatio: 100.0},
+		},
+	}
+
+	queryVideoTemplate = CategoryTemplate{
+		Layout:     "grid",
+		CardLayout: "horizontal",
+		CardSize:   "small",
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "art", AspectRatio: 1.5, FillMode: "fit"},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+
+	listCategoryTemplate = CategoryTemplate{
+		Layout:     "grid",
+		CardLayout: "horizontal",
+		CardSize:   "small",
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "art", AspectRatio: 1.5},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+)
+
+func videoCategoryTemplate(size string) CategoryTemplate {
+	return CategoryTemplate{
+		Layout:   "grid",
+		CardSize: size,
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "art", AspectRatio: 1.5},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+}
+
+func posterCategoryTemplate(size string) CategoryTemplate {
+	return CategoryTemplate{
+		Layout:   "grid",
+		CardSize: size,
+		Components: Components{
+			Title:      "title",
+			Subtitle:   "subtitle",
+			Art:        &ArtComponent{Field: "poster", AspectRatio: 0.7},
+			Emblem:     "emblem",
+			Attributes: "attributes",
+		},
+	}
+}
+
+// Card layouts of the categories
+const (
+	layoutLandscape = "landscape"
+	layoutPoster    = "poster"
+	layoutList      = "list"
+)
+
+// categoryLayouts maps "<kind>/<category>" to the card layout, the others
+// are in layoutLandscape
+var categoryLayouts = map[string]string{
+	"show/电影":  layoutPoster,
+	"show/电视剧": layoutPoster,
+	"show/动漫":  layoutPoster,
+	"video/资讯": layoutList,
+}
+
+func categoryLayout(kind, category string) string {
+	if layout, ok := categoryLayouts[kind+"/"+category]; ok {
+		return layout
+	}
+	// news like 体育资讯, 财经资讯
+	if kind == "video" && strings.HasSuffix(category, "资讯") {
+		return layoutList
+	}
+	return layoutLandscape
+}
+
+// categoryTemplate returns the category template for the videos or shows
+// of category
+func categoryTemplate(kind, category string) string {
+	switch categoryLayout(kind, category) {
+	case layoutPoster:
+		return posterCategoryTemplate(itemSize).JSON()
+	case layoutList:
+		return listCategoryTemplate.JSON()
+	}
+	return videoCategoryTemplate(itemSize).JSON()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// allTemplates returns every template the scope registers categories with
+func allTemplates() map[string]string {
+	templates := map[string]string{
+		"home":        homeCategoryTemplate.JSON(),
+		"large video": largeVideoCategoryTemplate.JSON(),
+		"login nag":   loginNagTemplate.JSON(),
+		"query video": queryVideoTemplate.JSON(),
+		"list":        listCategoryTemplate.JSON(),
+	}
+	for _, size := range itemSizes {
+		templates["video "+size] = videoCategoryTemplate(size).JSON()
+		templates["poster "+size] = posterCategoryTemplate(size).JSON()
+	}
+	for key := range categoryLayouts {
+		kind := strings.SplitN(key, "/", 2)
+		templates["category "+key] = categoryTemplate(kind[0], kind[1])
+	}
+	templates["category video/体育资讯"] = categoryTemplate("video", "体育资讯")
+	templates["category video/音乐"] = categoryTemplate("video", "音乐")
+	return templates
+}
+
+func TestTemplatesValidate(t *testing.T) {
+	templates := map[string]CategoryTemplate{
+		"home":        homeCategoryTemplate,
+		"large video": largeVideoCategoryTemplate,
+		"login nag":   loginNagTemplate,
+		"query video": queryVideoTemplate,
+		"list":        listCategoryTemplate,
+	}
+	for _, size := range itemSizes {
+		templates["video "+size] = videoCategoryTemplate(size)
+		templates["poster "+size] = posterCategoryTemplate(size)
+	}
+	for name, template := range templates {
+		if err := template.Validate(); err != nil {
+			t.Errorf("template %s: %v", name, err)
+		}
+	}
+}
+
+func TestTemplatesSchema(t *testing.T) {
+	layouts := map[string]bool{"grid": true, "carousel": true, "vertical-journal": true, "horizontal-list": true}
+	sizes := map[string]bool{"small": true, "medium": true, "large": true}
+	components := map[string]bool{
+		"title": true, "subtitle": true, "art": true, "mascot": true,
+		"emblem": true, "summary": true, "attributes": true,
+	}
+
+	for name, data := range allTemplates() {
+		var v struct {
+			SchemaVersion int                    `json:"schema-version"`
+			Template      map[string]interface{} `json:"template"`
+			Components    map[string]interface{} `json:"components"`
+		}
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			t.Errorf("template %s: %v", name, err)
+			continue
+		}
+		if v.SchemaVersion != templateSchemaVersion {
+			t.Errorf("template %s: schema-version %d", name, v.SchemaVersion)
+		}
+		if layout, _ := v.Template["category-layout"].(string); !layouts[layout] {
+			t.Errorf("template %s: category-layout %q", name, layout)
+		}
+		if size, ok := v.Template["card-size"]; ok {
+			if s, _ := size.(string); !sizes[s] {
+				t.Errorf("template %s: card-size %v", name, size)
+			}
+		}
+		if len(v.Components) == 0 {
+			t.Errorf("template %s: no components", name)
+		}
+		for key := range v.Components {
+			if !components[key] {
+				t.Errorf("template %s: unknown component %q", name, key)
+			}
+		}
+	}
+}
+
+// The templates as written in JSON before they were built from
+// CategoryTemplate, with the emblem of paid shows added
+var baselineTemplates = map[string]string{
+	"home": `{
+		"schema-version": 1,
+		"template": {"category-layout": "carousel", "card-size": "large", "overlay": true},
+		"components": {
+			"title": "title",
+			"subtitle": "subtitle",
+			"art": {"field": "art", "aspect-ratio": 1.4},
+			"emblem": "emblem",
+			"attributes": "attributes"
+		}
+	}`,
+	"video medium": `{
+		"schema-version": 1,
+		"template": {"category-layout": "grid", "card-size": "medium"},
+		"components": {
+			"title": "title",
+			"subtitle": "subtitle",
+			"art": {"field": "art", "aspect-ratio": 1.5},
+			"emblem": "emblem",
+			"attributes": "attributes"
+		}
+	}`,
+	"large video": `{
+		"schema-version": 1,
+		"template": {"category-layout": "vertical-journal", "card-size": "large", "overlay": true},
+		"components": {
+			"title": "title",
+			"subtitle": "subtitle",
+			"art": {"field": "art", "aspect-ratio": 2.5},
+			"emblem": "emblem",
+			"attributes": "attributes"
+		}
+	}`,
+	"login nag": `{
+		"schema-version": 1,
+		"template": {"category-layout": "vertical-journal", "card-size": "large", "card-background": "color:///#06A7E1"},
+		"components": {
+			"title": "title",
+			"art": {"aspect-ratio": 100.0}
+		}
+	}`,
+	"query video": `{
+		"schema-version": 1,
+		"template": {"category-layout": "grid", "card-layout": "horizontal", "card-size": "small"},
+		"components": {
+			"title": "title",
+			"subtitle": "subtitle",
+			"art": {"field": "art", "fill-mode": "fit", "aspect-ratio": 1.5},
+			"emblem": "emblem",
+			"attributes": "attributes"
+		}
+	}`,
+}
+
+func TestTemplatesBaseline(t *testing.T) {
+	templates := allTemplates()
+	for name, want := range baselineTemplates {
+		var got, expected interface{}
+		if err := json.Unmarshal([]byte(templates[name]), &got); err != nil {
+			t.Errorf("template %s: %v", name, err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(want), &expected); err != nil {
+			t.Fatalf("baseline %s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("template %s:\n%s\nwant:\n%s", name, templates[name], want)
+		}
+	}
+}
+
+// The cards of videos and shows have the art, the emblem of paid shows and
+// the badges
+func TestTemplatesCardComponents(t *testing.T) {
+	for name, data := range allTemplates() {
+		if name == "login nag" {
+			continue
+		}
+		var v struct {
+			Components struct {
+				Art *struct {
+					Field       string  `json:"field"`
+					AspectRatio float64 `json:"aspect-ratio"`
+				} `json:"art"`
+				Emblem     string `json:"emblem"`
+				Attributes string `json:"attributes"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			t.Errorf("template %s: %v", name, err)
+			continue
+		}
+		c := v.Components
+		if c.Art == nil || c.Art.AspectRatio <= 0 || (c.Art.Field != "art" && c.Art.Field != "poster") {
+			t.Errorf("template %s: art %+v", name, c.Art)
+		}
+		if c.Emblem != "emblem" {
+			t.Errorf("template %s: emblem %q", name, c.Emblem)
+		}
+		if c.Attributes != "attributes" {
+			t.Errorf("template %s: attributes %q", name, c.Attributes)
+		}
+	}
+}
@@ -3,52 +3,90 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 )
 
 // Video information from Youku
 type Video struct {
-	ID            string      `json:"id"`
-	Title         string      `json:"title"`
-	Link          string      `json:"link"`
-	Thumbnail     string      `json:"thumbnail"`
-	BigThumbnail  string      `json:"bigThumbnail"`
-	Duration      float64     `json:"duration"`
-	Category      string      `json:"category"`
-	State         string      `json:"state"`
-	ViewCount     interface{} `json:"view_count"`
-	FavoriteCount interface{} `json:"favorite_count"`
-	CommentCount  interface{} `json:"comment_count"`
-	UpCount       interface{} `json:"up_count"`
-	DownCount     interface{} `json:"down_count"`
-	Published     string      `json:"published"`
-	FavoriteTime  string      `json:"favorite_time"`
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	Link          string    `json:"link"`
+	Thumbnail     string    `json:"thumbnail"`
+	BigThumbnail  string    `json:"bigThumbnail"`
+	Duration      FlexFloat `json:"duration"`
+	Category      string    `json:"category"`
+	State         string    `json:"state"`
+	ViewCount     FlexInt   `json:"view_count"`
+	FavoriteCount FlexInt   `json:"favorite_count"`
+	CommentCount  FlexInt   `json:"comment_count"`
+	UpCount       FlexInt   `json:"up_count"`
+	DownCount     FlexInt   `json:"down_count"`
+	Published     string    `json:"published"`
+	FavoriteTime  string    `json:"favorite_time"`
 }
 
 // VideoDetail to save detail information of video
 type VideoDetail struct {
 	Video
-	BigThumbnail  string `json:"bitThumbnail"`
-	Created       string `json:"created"`
-	Duration      string `json:"duration"`
-	Description   string `json:"description"`
-	Player        string `json:"player"`
-	PublicType    string `json:"public_type"`
-	CopyrightType string `json:"copyright_type"`
-	Tags          string `json:"tags"`
-	Screenshots   []struct {
+	Created        string    `json:"created"`
+	Description    string    `json:"description"`
+	Player         string    `json:"player"`
+	PublicType     string    `json:"public_type"`
+	CopyrightType  string    `json:"copyright_type"`
+	Tags           string    `json:"tags"`
+	StreamTypes    []string  `json:"streamtypes"`
+	OperationLimit []string  `json:"operation_limit"`
+	ReferenceCount FlexInt   `json:"reference_count"`
+	User           User      `json:"user"`
+	Show           VideoShow `json:"show"`
+	Source         struct {
+		ID   FlexInt `json:"id"`
+		Name string  `json:"name"`
+		Link string  `json:"link"`
+	} `json:"source"`
+	Screenshots []struct {
 		Sequence int    `json:"seq"`
 		URL      string `json:"url"`
 		BigURL   string `json:"big_url"`
 		SmallURL string `json:"small_url"`
 		IsCover  int    `json:"is_cover"`
 	} `json:"thumbnails"`
-	FavoriteCount string `json:"favorite_count"`
-	CommentCount  string `json:"comment_count"`
-	UpCount       string `json:"up_count"`
-	DownCount     string `json:"down_count"`
+}
+
+// VideoShow to save the show which a video belongs to
+type VideoShow struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Link        string  `json:"link"`
+	Type        string  `json:"type"`
+	Sequence    FlexInt `json:"seq"`
+	Stage       FlexInt `json:"stage"`
+	CollectTime string  `json:"collect_time"`
+}
+
+var videoLinkPattern = regexp.MustCompile(`/id_([0-9A-Za-z=]+)\.html`)
+
+// videoIDOfLink returns the ID of video in a link like
+// "http://v.youku.com/v_show/id_XMTIzNDU2.html", "" if not found
+func videoIDOfLink(link string) string {
+	if m := videoLinkPattern.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Operation limits of video
+var operationLimitLabels = map[string]string{
+	"COMMENT_DISABLED":  "禁止评论",
+	"DOWNLOAD_DISABLED": "禁止下载",
+}
+
+// Downloadable reports whether the uploader allows to download video
+func (v VideoDetail) Downloadable() bool {
+	return !isContainsKey("DOWNLOAD_DISABLED", v.OperationLimit)
 }
 
 // VideoCategory to save categories of videos
@@ -67,27 +105,32 @@ type VideoGenres struct {
 	Lang  string
 }
 
-func getVideoCategories(path string) []VideoCategory {
-
-	f, err := ioutil.ReadFile(path + "/data/category.json")
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return []VideoCategory{}
-	}
-
-	var data struct {
-		Video []VideoCategory
+// getVideoCategories returns the categories from Youku merged over the
+// bundled data/category.json
+func getVideoCategories(scopePath, cachePath string) []VideoCategory {
+	categories := []VideoCategory{}
+	for _, raw := range loadCategories("video", scopePath, cachePath) {
+		var c VideoCategory
+		if err := json.Unmarshal(raw, &c); err != nil {
+			logger.Println("[ERROR]", err)
+			continue
+		}
+		categories = append(categories, c)
 	}
+	return categories
+}
 
-	err = json.Unmarshal(f, &data)
+func getVideosByCategory(category, genre, period, orderby string, page, count int) []Video {
+	videos, err := fetchVideosByCategory(category, genre, period, orderby, page, count)
 	if err != nil {
 		logger.Println("[ERROR]", err)
-		return []VideoCategory{}
+		return []Video{}
 	}
-	return data.Video
+	return videos
 }
 
-func getVideosByCategory(category, genre, period, orderby string, page, count int) []Video {
+// fetchVideosByCategory is getVideosByCategory returning the error
+func fetchVideosByCategory(category, genre, period, orderby string, page, count int) ([]Video, error) {
 
 	api := baseAPI + "videos/by_category.json"
 	v := &url.Values{}
@@ -100,24 +143,45 @@ func getVideosByCategory(category, genre, period, orderby string, page, count in
 	v.Set("count", fmt.Sprint(count))
 	api += "?" + v.Encode()
 
-	res, err := http.Get(api)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return []Video{}
-	}
-	defer res.Body.Close()
-
 	var data struct {
 		Total  int
 		Page   int
 		Count  int
 		Videos []Video `json:"videos"`
 	}
+	if err := getAPI(api, &data); err != nil {
+		return nil, err
+	}
+	return data.Videos, nil
+}
 
-	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&data)
+// getVideosByUser returns the videos uploaded by user, user is the ID if
+// it is a number, otherwise the name
+func getVideosByUser(user, orderby string, page, count int) ([]Video, error) {
+
+	api := baseAPI + "videos/by_user.json"
+	v := &url.Values{}
+	v.Set("client_id", clientID)
+	if _, err := strconv.Atoi(user); err == nil {
+		v.Set("user_id", user)
+	} else {
+		v.Set("user_name", user)
+	}
+	v.Set("orderby", orderby)
+	v.Set("page", fmt.Sprint(page))
+	v.Set("count", fmt.Sprint(count))
+	api += "?" + v.Encode()
 
-	return data.Videos
+	var data struct {
+		Total  int
+		Page   int
+		Count  int
+		Videos []Video `json:"videos"`
+	}
+	if err := getAPI(api, &data); err != nil {
+		return nil, err
+	}
+	return data.Videos, nil
 }
 
 func getVideoDetail(videoID string) VideoDetail {
@@ -139,12 +203,24 @@ func getVideoDetail(videoID string) VideoDetail {
 	var video VideoDetail
 
 	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&video)
+	if err := decoder.Decode(&video); err != nil {
+		logger.Println("[ERROR]", "json parse", err)
+	}
 
 	return video
 }
 
 func queryVideosByKeyword(keyword, category, period, orderby string, count int) []VideoDetail {
+	videos, err := fetchVideosByKeyword(keyword, category, period, orderby, count)
+	if err != nil {
+		logger.Println("[ERROR]", err)
+		return []VideoDetail{}
+	}
+	return videos
+}
+
+// fetchVideosByKeyword is queryVideosByKeyword returning the error
+func fetchVideosByKeyword(keyword, category, period, orderby string, count int) ([]VideoDetail, error) {
 	api := baseAPI + "searches/video/by_keyword.json"
 	v := &url.Values{}
 	v.Set("client_id", clientID)
@@ -158,21 +234,12 @@ func queryVideosByKeyword(keyword, category, period, orderby string, count int)
 
 	logger.Printf("[QUERY VIDEOS] %s %s %s %s %d\n", keyword, category, period, orderby, count)
 
-	res, err := http.Get(api)
-	if err != nil {
-		logger.Println("[ERROR]", err)
-		return []VideoDetail{}
-	}
-	defer res.Body.Close()
-
 	var data struct {
 		Total  int
 		Videos []VideoDetail `json:"videos"`
 	}
-
-	decoder := json.NewDecoder(res.Body)
-	decoder.Decode(&data)
-
-	return data.Videos
-
+	if err := getAPI(api, &data); err != nil {
+		return nil, err
+	}
+	return data.Videos, nil
 }